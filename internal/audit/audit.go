@@ -0,0 +1,71 @@
+package audit
+
+import (
+	"my-project/internal/helper"
+	"my-project/internal/logger"
+	"my-project/internal/model"
+	"my-project/internal/token"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Event is what a handler reports; the request fills in the rest
+type Event struct {
+	Action   model.AuditAction
+	ActorID  uint   // Who acted, taken from the authenticated request when zero
+	TargetID uint   // Whose account is affected, the actor's when zero
+	Email    string // Identifies the account when there is no user, e.g. a sign in with an unknown email
+	Metadata map[string]interface{}
+}
+
+// Record stores the event with the caller's IP and user agent through db, which may be a transaction.
+// A failed write is logged instead of returned so auditing never fails the action it describes.
+func Record(c *gin.Context, db *gorm.DB, event Event) {
+	entry := newAuditEvent(c, event)
+	if err := db.Create(entry).Error; err != nil {
+		logger.ErrorLogger.Error("Failed to record audit event",
+			zap.Error(err),
+			zap.String("action", string(entry.Action)),
+			zap.Uintp("actor_id", entry.ActorID),
+			zap.Uintp("target_id", entry.TargetID),
+		)
+	}
+}
+
+// newAuditEvent builds the row for an event raised while handling the request
+func newAuditEvent(c *gin.Context, event Event) *model.AuditEvent {
+	entry := &model.AuditEvent{
+		Action:    event.Action,
+		Email:     event.Email,
+		IP:        c.ClientIP(),
+		UserAgent: helper.TruncateString(c.Request.UserAgent(), 512),
+		Metadata:  event.Metadata,
+	}
+
+	actorID := event.ActorID
+	if user, exists := c.Get("user"); exists {
+		if claims, ok := user.(*token.Claims); ok {
+			if actorID == 0 {
+				actorID = claims.ID
+			}
+			if claims.Act != nil {
+				entry.ImpersonatorID = &claims.Act.ID
+			}
+		}
+	}
+
+	targetID := event.TargetID
+	if targetID == 0 {
+		targetID = actorID
+	}
+
+	if actorID != 0 {
+		entry.ActorID = &actorID
+	}
+	if targetID != 0 {
+		entry.TargetID = &targetID
+	}
+	return entry
+}
@@ -0,0 +1,59 @@
+package audit
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"my-project/internal/model"
+	"my-project/internal/token"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestContext() *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/api/v1/auth/signin", nil)
+	c.Request.RemoteAddr = "203.0.113.7:4321"
+	c.Request.Header.Set("User-Agent", "test-agent")
+	return c
+}
+
+func TestNewAuditEventAnonymous(t *testing.T) {
+	c := newTestContext()
+
+	entry := newAuditEvent(c, Event{Action: model.AuditSignInFailed, Email: "jane@example.com"})
+
+	if entry.ActorID != nil || entry.TargetID != nil {
+		t.Fatalf("anonymous event got actor %v and target %v", entry.ActorID, entry.TargetID)
+	}
+	if entry.Email != "jane@example.com" || entry.IP != "203.0.113.7" || entry.UserAgent != "test-agent" {
+		t.Fatalf("unexpected event: %+v", entry)
+	}
+}
+
+func TestNewAuditEventTargetDefaultsToActor(t *testing.T) {
+	c := newTestContext()
+
+	entry := newAuditEvent(c, Event{Action: model.AuditSignIn, ActorID: 7})
+
+	if entry.ActorID == nil || *entry.ActorID != 7 || entry.TargetID == nil || *entry.TargetID != 7 {
+		t.Fatalf("expected actor and target 7, got %v and %v", entry.ActorID, entry.TargetID)
+	}
+}
+
+func TestNewAuditEventFromClaims(t *testing.T) {
+	c := newTestContext()
+	c.Set("user", &token.Claims{ID: 3, Act: &token.Actor{ID: 1}})
+
+	entry := newAuditEvent(c, Event{Action: model.AuditRoleAssigned, TargetID: 9})
+
+	if entry.ActorID == nil || *entry.ActorID != 3 {
+		t.Fatalf("expected actor 3 from the claims, got %v", entry.ActorID)
+	}
+	if entry.TargetID == nil || *entry.TargetID != 9 {
+		t.Fatalf("expected target 9, got %v", entry.TargetID)
+	}
+	if entry.ImpersonatorID == nil || *entry.ImpersonatorID != 1 {
+		t.Fatalf("expected impersonator 1, got %v", entry.ImpersonatorID)
+	}
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"fmt"
+	"my-project/internal/helper"
 	"my-project/internal/logger"
 	"my-project/internal/model"
 	"os"
@@ -103,8 +104,25 @@ func New() Service {
 		&model.User{},
 		&model.UserDetail{},
 		&model.RefreshToken{},
+		&model.PasswordResetToken{},
+		&model.VerificationEmail{},
+		&model.TotpFactor{},
+		&model.RecoveryCode{},
+		&model.WebauthnCredential{},
+		&model.WebauthnSession{},
+		&model.FailedLoginAttempt{},
+		&model.AccountUnlockToken{},
 		&model.Image{},
 		&model.SocialProfile{},
+		&model.PendingSocialLink{},
+		&model.AuthorizationCode{},
+		&model.MagicLinkToken{},
+		&model.PhoneOtp{},
+		&model.APIKey{},
+		&model.RevokedToken{},
+		&model.Permission{},
+		&model.Role{},
+		&model.AuditEvent{},
 		&model.Search{},
 		&model.Response{},
 	); err != nil {
@@ -113,6 +131,27 @@ func New() Service {
 			zap.String("database", dbname))
 	}
 
+	// Replace plaintext refresh tokens with their digest
+	if err := migrateRefreshTokenHashes(db); err != nil {
+		logger.AppLogger.Fatal("Refresh token hash migration failed",
+			zap.Error(err),
+			zap.String("database", dbname))
+	}
+
+	// Give refresh tokens created before token families their own family
+	if err := db.Model(&model.RefreshToken{}).Where("family_id = ?", "").Update("family_id", gorm.Expr("UUID()")).Error; err != nil {
+		logger.AppLogger.Fatal("Refresh token family backfill failed",
+			zap.Error(err),
+			zap.String("database", dbname))
+	}
+
+	// Make sure the built-in roles and permissions exist
+	if err := seedRoles(db); err != nil {
+		logger.AppLogger.Fatal("Role seeding failed",
+			zap.Error(err),
+			zap.String("database", dbname))
+	}
+
 	logger.AppLogger.Info("Database migration completed successfully",
 		zap.String("database", dbname))
 
@@ -120,6 +159,101 @@ func New() Service {
 	return dbInstance
 }
 
+// migrateRefreshTokenHashes hashes refresh tokens that were stored in plaintext and drops the old column
+func migrateRefreshTokenHashes(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&model.RefreshToken{}, "token") {
+		return nil
+	}
+
+	logger.AppLogger.Info("Migrating plaintext refresh tokens to hashes")
+
+	var rows []struct {
+		ID    uint
+		Token string
+	}
+	if err := db.Table(model.RefreshToken{}.TableName()).Select("id", "token").Where("token_hash = ?", "").Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if err := db.Table(model.RefreshToken{}.TableName()).Where("id = ?", row.ID).Update("token_hash", helper.HashToken(row.Token)).Error; err != nil {
+			return err
+		}
+	}
+
+	return db.Migrator().DropColumn(&model.RefreshToken{}, "token")
+}
+
+// builtinPermissions are created on startup together with their description
+var builtinPermissions = map[string]string{
+	model.PermissionSearchReadOwn:    "Read own searches",
+	model.PermissionSearchWriteOwn:   "Create AI responses",
+	model.PermissionSearchReadAny:    "Read searches of any user",
+	model.PermissionRolesManage:      "Manage roles and assign them to users",
+	model.PermissionUsersRead:        "List and view users",
+	model.PermissionUsersManage:      "Verify, disable, ban, sign out, delete and restore users",
+	model.PermissionUsersImpersonate: "Act as another user with a short-lived token",
+	model.PermissionAuditRead:        "Read the security audit log of every user",
+}
+
+// builtinRoles lists the permissions every built-in role has at least, admins can grant more
+var builtinRoles = map[model.UserRole][]string{
+	model.RoleUser: {
+		model.PermissionSearchReadOwn,
+		model.PermissionSearchWriteOwn,
+	},
+	model.RoleAdmin: {
+		model.PermissionSearchReadOwn,
+		model.PermissionSearchWriteOwn,
+		model.PermissionSearchReadAny,
+		model.PermissionRolesManage,
+		model.PermissionUsersRead,
+		model.PermissionUsersManage,
+		model.PermissionUsersImpersonate,
+		model.PermissionAuditRead,
+	},
+}
+
+// seedRoles creates missing built-in permissions and roles. Built-in permissions are granted only
+// when the role or the permission is created, so grants an admin took away stay revoked across restarts.
+func seedRoles(db *gorm.DB) error {
+	permissions := map[string]model.Permission{}
+	createdPermissions := map[string]bool{}
+	for name, description := range builtinPermissions {
+		permission := model.Permission{Name: name}
+		result := db.Where(permission).Attrs(model.Permission{Description: description}).FirstOrCreate(&permission)
+		if result.Error != nil {
+			return result.Error
+		}
+		permissions[name] = permission
+		createdPermissions[name] = result.RowsAffected > 0
+	}
+
+	for roleName, grants := range builtinRoles {
+		role := model.Role{Name: string(roleName)}
+		result := db.Where(role).FirstOrCreate(&role)
+		if result.Error != nil {
+			return result.Error
+		}
+		roleCreated := result.RowsAffected > 0
+
+		var rolePermissions []model.Permission
+		for _, name := range grants {
+			if roleCreated || createdPermissions[name] {
+				rolePermissions = append(rolePermissions, permissions[name])
+			}
+		}
+		if len(rolePermissions) == 0 {
+			continue
+		}
+		if err := db.Model(&role).Association("Permissions").Append(rolePermissions); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Custom writer for GORM that uses our QueryLogger
 type GormWriter struct{}
 
@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"my-project/internal/audit"
+	"my-project/internal/helper"
+	"my-project/internal/model"
+	"my-project/internal/response"
+	"my-project/internal/validation"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// accountExport is everything stored about a user, as handed out by ExportData
+type accountExport struct {
+	ExportedAt time.Time      `json:"exported_at"`
+	User       model.User     `json:"user"`
+	Searches   []model.Search `json:"searches"`
+}
+
+// ExportData answers with a ZIP of the user's account, profile, linked providers, search history
+// and avatar, or with the same data as a JSON document when format=json
+func (h *UserHandler) ExportData(c *gin.Context) {
+	userInfo, err := helper.GetUserInfoFromContext(c)
+	if err != nil {
+		response.ApiError(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	export := accountExport{ExportedAt: time.Now()}
+	if err := h.db.DB().Preload("UserDetail").Preload("UserDetail.Image").Preload("SocialProfiles").First(&export.User, userInfo.ID).Error; err != nil {
+		response.ApiError(c, http.StatusNotFound, "User not found")
+		return
+	}
+
+	// Searches the user deleted are still stored, so they are part of the export
+	if err := h.db.DB().Unscoped().Preload("Responses", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at ASC")
+	}).Where("user_id = ?", userInfo.ID).Order("created_at ASC").Find(&export.Searches).Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to fetch search history", err.Error())
+		return
+	}
+
+	audit.Record(c, h.db.DB(), audit.Event{Action: model.AuditDataExported, Metadata: map[string]interface{}{"format": c.DefaultQuery("format", "zip")}})
+
+	filename := fmt.Sprintf("account-export-%d-%s", userInfo.ID, export.ExportedAt.Format("20060102150405"))
+	if c.Query("format") == "json" {
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, filename))
+		c.JSON(http.StatusOK, export)
+		return
+	}
+
+	archive, err := buildExportArchive(&export)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to build export", err.Error())
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, filename))
+	c.Data(http.StatusOK, "application/zip", archive)
+}
+
+// buildExportArchive zips the export as account.json and searches.json, plus the avatar file when there is one
+func buildExportArchive(export *accountExport) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+
+	files := map[string]interface{}{
+		"account.json": gin.H{
+			"exported_at": export.ExportedAt,
+			"user":        export.User,
+		},
+		"searches.json": export.Searches,
+	}
+	for name, content := range files {
+		w, err := archive.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(content); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+
+	if detail := export.User.UserDetail; detail != nil && detail.Image != nil && detail.Image.DiskType == model.DiskTypeLocal {
+		path, err := helper.LocalFilePath(detail.Image.Path)
+		if err != nil {
+			return nil, err
+		}
+		avatar, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read avatar: %w", err)
+		}
+		if err == nil {
+			w, err := archive.Create("avatar/" + filepath.Base(detail.Image.ModifiedName))
+			if err != nil {
+				return nil, err
+			}
+			if _, err := w.Write(avatar); err != nil {
+				return nil, fmt.Errorf("failed to write avatar: %w", err)
+			}
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DeleteAccount soft-deletes the authenticated user and ends every session. The account and its
+// files are purged for good once the grace period is over; until then an admin can restore it.
+func (h *UserHandler) DeleteAccount(c *gin.Context) {
+	userInfo, err := helper.GetUserInfoFromContext(c)
+	if err != nil {
+		response.ApiError(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	req, err := helper.GetValidatedFromContext[validation.DeleteAccountRequest](c)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var user model.User
+	if err := h.db.DB().First(&user, userInfo.ID).Error; err != nil {
+		response.ApiError(c, http.StatusNotFound, "User not found")
+		return
+	}
+
+	// Social sign ups confirm with the temporary password they got by email
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		response.ApiError(c, http.StatusUnauthorized, "Password is incorrect")
+		return
+	}
+
+	// A stolen session plus the password must not be enough when the account has a second factor
+	mfaEnabled, err := hasMfaEnabled(h.db.DB(), user.ID)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to check two-factor authentication", err.Error())
+		return
+	}
+	if mfaEnabled {
+		if req.Code == "" && req.RecoveryCode == "" {
+			response.ApiError(c, http.StatusUnauthorized, "Authentication code required")
+			return
+		}
+		valid, err := verifySecondFactor(h.db.DB(), user.ID, req.Code, req.RecoveryCode)
+		if err != nil {
+			response.ApiError(c, http.StatusInternalServerError, "Failed to verify authentication code", err.Error())
+			return
+		}
+		if !valid {
+			response.ApiError(c, http.StatusUnauthorized, "Invalid authentication code")
+			return
+		}
+	}
+
+	purgeAfter := time.Now().Add(time.Second * time.Duration(helper.GetEnvInt64("ACCOUNT_DELETION_GRACE_PERIOD", 30*24*3600)))
+	err = h.db.DB().Transaction(func(tx *gorm.DB) error {
+		if err := signOutEverywhere(tx, user.ID); err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&model.APIKey{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&user).Update("purge_after", purgeAfter).Error; err != nil {
+			return err
+		}
+		audit.Record(c, tx, audit.Event{Action: model.AuditAccountDeleted, Metadata: map[string]interface{}{"purge_after": purgeAfter}})
+		return tx.Delete(&user).Error
+	})
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to delete account", err.Error())
+		return
+	}
+
+	// Clear the refresh token cookie
+	clearRefreshTokenCookie(c)
+
+	response.SendResponse(c, http.StatusOK, true, "Account deleted, your data will be removed permanently after the grace period", gin.H{
+		"user_id":     user.ID,
+		"purge_after": purgeAfter,
+	}, nil)
+}
@@ -0,0 +1,339 @@
+package handler
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"my-project/internal/audit"
+	"my-project/internal/database"
+	"my-project/internal/helper"
+	"my-project/internal/model"
+	"my-project/internal/rbac"
+	"my-project/internal/response"
+	"my-project/internal/token"
+	"my-project/internal/types"
+	"my-project/internal/validation"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// adminUserSortFields are the columns users can be sorted by
+var adminUserSortFields = []string{"created_at", "updated_at", "name", "email"}
+
+type AdminUserHandler struct {
+	db          database.Service
+	tokens      token.Service
+	permissions *rbac.Service
+}
+
+func NewAdminUserHandler(db database.Service, tokens token.Service, permissions *rbac.Service) *AdminUserHandler {
+	return &AdminUserHandler{db: db, tokens: tokens, permissions: permissions}
+}
+
+// GetUsers lists users with pagination, searching name and email
+func (h *AdminUserHandler) GetUsers(c *gin.Context) {
+	var filters struct {
+		types.CommonFilters
+		Verified *bool   `form:"verified"`
+		Role     *string `form:"role"`
+		Status   *string `form:"status"`
+		Provider *string `form:"provider"`
+		Deleted  bool    `form:"deleted"` // Only soft-deleted users
+	}
+	if err := c.ShouldBindQuery(&filters); err != nil {
+		response.ApiError(c, http.StatusBadRequest, "Invalid query parameters")
+		return
+	}
+
+	options := helper.GetDefaultPaginationOptions(filters.CommonFilters)
+	if !slices.Contains(adminUserSortFields, options.SortBy) || (options.SortOrder != "asc" && options.SortOrder != "desc") {
+		response.ApiError(c, http.StatusBadRequest, "Invalid sort parameters")
+		return
+	}
+
+	filterMap := map[string]interface{}{
+		"searchTerm": filters.SearchTerm,
+	}
+	if filters.Verified != nil {
+		filterMap["is_verified"] = *filters.Verified
+	}
+	if filters.Role != nil && *filters.Role != "" {
+		filterMap["role"] = *filters.Role
+	}
+	if filters.Status != nil && *filters.Status != "" {
+		filterMap["status"] = *filters.Status
+	}
+	searchFields := []string{"name", "email"}
+
+	query := h.db.DB()
+	if filters.Deleted {
+		query = query.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+	if filters.Provider != nil && *filters.Provider != "" {
+		query = query.Where("id IN (?)", h.db.DB().Model(&model.SocialProfile{}).Select("user_id").Where("provider = ?", *filters.Provider))
+	}
+
+	result, err := helper.GetPaginatedResults[model.User](
+		query,
+		options,
+		filterMap,
+		searchFields,
+	)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to fetch users")
+		return
+	}
+
+	response.SendResponse(c, http.StatusOK, true, "Users fetched successfully", result, nil)
+}
+
+// GetUser returns a user, deleted ones included, with their details and social profiles
+func (h *AdminUserHandler) GetUser(c *gin.Context) {
+	var user model.User
+	if err := h.db.DB().Unscoped().Preload("UserDetail.Image").Preload("SocialProfiles").First(&user, c.Param("id")).Error; err != nil {
+		response.ApiError(c, http.StatusNotFound, "User not found")
+		return
+	}
+
+	response.SendResponse(c, http.StatusOK, true, "User fetched successfully", user, nil)
+}
+
+// VerifyUser marks the user's email as verified
+func (h *AdminUserHandler) VerifyUser(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.db.DB().Model(user).Update("is_verified", true).Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to verify user", err.Error())
+		return
+	}
+	audit.Record(c, h.db.DB(), audit.Event{Action: model.AuditUserVerified, TargetID: user.ID})
+
+	response.SendResponse(c, http.StatusOK, true, "User verified successfully", gin.H{
+		"user_id": user.ID,
+	}, nil)
+}
+
+// SetUserStatus disables, bans or reactivates a user. Disabling and banning also end every session.
+func (h *AdminUserHandler) SetUserStatus(c *gin.Context) {
+	req, err := helper.GetValidatedFromContext[validation.UserStatusRequest](c)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	user, ok := h.findOtherUser(c)
+	if !ok {
+		return
+	}
+
+	status := model.UserStatus(req.Status)
+	reason := req.Reason
+	if status == model.UserActive {
+		reason = ""
+	}
+
+	err = h.db.DB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{"status": status, "status_reason": reason}).Error; err != nil {
+			return err
+		}
+		audit.Record(c, tx, audit.Event{
+			Action:   model.AuditUserStatusChanged,
+			TargetID: user.ID,
+			Metadata: map[string]interface{}{"from": user.Status, "to": status, "reason": reason},
+		})
+		if status != model.UserActive {
+			return signOutEverywhere(tx, user.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to update user status", err.Error())
+		return
+	}
+
+	response.SendResponse(c, http.StatusOK, true, "User status updated successfully", gin.H{
+		"user_id": user.ID,
+		"status":  status,
+	}, nil)
+}
+
+// SignOutUser ends every session of the user and invalidates their access tokens
+func (h *AdminUserHandler) SignOutUser(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+
+	if err := signOutEverywhere(h.db.DB(), user.ID); err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to sign out user", err.Error())
+		return
+	}
+	audit.Record(c, h.db.DB(), audit.Event{Action: model.AuditUserSignedOut, TargetID: user.ID})
+
+	response.SendResponse(c, http.StatusOK, true, "User signed out from every session", gin.H{
+		"user_id": user.ID,
+	}, nil)
+}
+
+// DeleteUser soft-deletes a user and ends their sessions, the user can be restored later
+func (h *AdminUserHandler) DeleteUser(c *gin.Context) {
+	user, ok := h.findOtherUser(c)
+	if !ok {
+		return
+	}
+
+	err := h.db.DB().Transaction(func(tx *gorm.DB) error {
+		if err := signOutEverywhere(tx, user.ID); err != nil {
+			return err
+		}
+		audit.Record(c, tx, audit.Event{Action: model.AuditUserDeleted, TargetID: user.ID})
+		return tx.Delete(user).Error
+	})
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to delete user", err.Error())
+		return
+	}
+
+	response.SendResponse(c, http.StatusOK, true, "User deleted successfully", gin.H{
+		"user_id": user.ID,
+	}, nil)
+}
+
+// RestoreUser undoes a soft delete, including one the user asked for that has not been purged yet
+func (h *AdminUserHandler) RestoreUser(c *gin.Context) {
+	var user model.User
+	if err := h.db.DB().Unscoped().Where("deleted_at IS NOT NULL").First(&user, c.Param("id")).Error; err != nil {
+		response.ApiError(c, http.StatusNotFound, "Deleted user not found")
+		return
+	}
+
+	if err := h.db.DB().Unscoped().Model(&user).Updates(map[string]interface{}{"deleted_at": nil, "purge_after": nil}).Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to restore user", err.Error())
+		return
+	}
+	audit.Record(c, h.db.DB(), audit.Event{Action: model.AuditUserRestored, TargetID: user.ID})
+
+	response.SendResponse(c, http.StatusOK, true, "User restored successfully", gin.H{
+		"user_id": user.ID,
+	}, nil)
+}
+
+// Impersonate issues a short-lived access token for the user that also names the admin as actor.
+// It has no refresh token, and every request made with it is recorded.
+func (h *AdminUserHandler) Impersonate(c *gin.Context) {
+	userInfo, err := helper.GetUserInfoFromContext(c)
+	if err != nil {
+		response.ApiError(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	user, ok := h.findOtherUser(c)
+	if !ok {
+		return
+	}
+	if user.Status != model.UserActive || !user.IsVerified {
+		response.ApiError(c, http.StatusConflict, "Only active, verified users can be impersonated")
+		return
+	}
+
+	// Impersonating another admin would hand out their permissions
+	targetCanImpersonate, err := h.permissions.HasPermission(string(user.Role), model.PermissionUsersImpersonate)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to check permissions", err.Error())
+		return
+	}
+	if targetCanImpersonate {
+		response.ApiError(c, http.StatusForbidden, "Users who can impersonate can't be impersonated")
+		return
+	}
+
+	subject := subjectFromUser(user)
+	subject.Actor = &token.Actor{ID: userInfo.ID, Email: userInfo.Email}
+	subject.TTL = time.Second * time.Duration(helper.GetEnvInt64("IMPERSONATION_EXPIRES_IN", 900))
+	accessToken, claims, err := h.tokens.Issue(token.Access, subject)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to generate impersonation token", err.Error())
+		return
+	}
+
+	audit.Record(c, h.db.DB(), audit.Event{Action: model.AuditImpersonation, TargetID: user.ID, Metadata: map[string]interface{}{"token_id": claims.RegisteredClaims.ID}})
+
+	response.SendResponse(c, http.StatusCreated, true, "Impersonation started", gin.H{
+		"access_token": accessToken,
+		"expires_at":   claims.ExpiresAt.Time,
+		"user_id":      user.ID,
+	}, nil)
+}
+
+// GetImpersonationLogs lists impersonation starts and impersonated requests from the audit log, newest first
+func (h *AdminUserHandler) GetImpersonationLogs(c *gin.Context) {
+	var filters struct {
+		types.CommonFilters
+		ActorID *uint `form:"actor_id"`
+		UserID  *uint `form:"user_id"`
+	}
+	if err := c.ShouldBindQuery(&filters); err != nil {
+		response.ApiError(c, http.StatusBadRequest, "Invalid query parameters")
+		return
+	}
+
+	query := h.db.DB().Where("action IN ?", []model.AuditAction{model.AuditImpersonation, model.AuditImpersonatedRequest})
+	// The admin started the impersonation themselves and is the impersonator of every request after
+	if filters.ActorID != nil {
+		query = query.Where("COALESCE(impersonator_id, actor_id) = ?", *filters.ActorID)
+	}
+	filterMap := map[string]interface{}{}
+	if filters.UserID != nil {
+		filterMap["target_id"] = *filters.UserID
+	}
+
+	result, ok := findAuditEvents(c, query, auditEventFilters{CommonFilters: filters.CommonFilters}, filterMap)
+	if !ok {
+		return
+	}
+
+	response.SendResponse(c, http.StatusOK, true, "Impersonation logs fetched successfully", result, nil)
+}
+
+// findUser loads the user of the :id parameter and answers 404 when it doesn't exist
+func (h *AdminUserHandler) findUser(c *gin.Context) (*model.User, bool) {
+	var user model.User
+	if err := h.db.DB().First(&user, c.Param("id")).Error; err != nil {
+		response.ApiError(c, http.StatusNotFound, "User not found")
+		return nil, false
+	}
+	return &user, true
+}
+
+// findOtherUser is findUser for actions admins must not apply to themselves
+func (h *AdminUserHandler) findOtherUser(c *gin.Context) (*model.User, bool) {
+	userInfo, err := helper.GetUserInfoFromContext(c)
+	if err != nil {
+		response.ApiError(c, http.StatusUnauthorized, err.Error())
+		return nil, false
+	}
+
+	user, ok := h.findUser(c)
+	if !ok {
+		return nil, false
+	}
+	if user.ID == userInfo.ID {
+		response.ApiError(c, http.StatusConflict, "You can't do this to your own account")
+		return nil, false
+	}
+	return user, true
+}
+
+// signOutEverywhere deletes every refresh token of the user and refuses access tokens issued until now
+func signOutEverywhere(db *gorm.DB, userID uint) error {
+	if err := db.Where("user_id = ?", userID).Delete(&model.RefreshToken{}).Error; err != nil {
+		return err
+	}
+	// Token timestamps have second precision
+	return db.Model(&model.User{}).Where("id = ?", userID).Update("tokens_revoked_at", time.Now().Truncate(time.Second)).Error
+}
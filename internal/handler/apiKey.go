@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"my-project/internal/audit"
+	"my-project/internal/database"
+	"my-project/internal/helper"
+	"my-project/internal/model"
+	"my-project/internal/response"
+	"my-project/internal/validation"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyHandler struct {
+	db database.Service
+}
+
+func NewAPIKeyHandler(db database.Service) *APIKeyHandler {
+	return &APIKeyHandler{db: db}
+}
+
+// CreateAPIKey creates an API key for the authenticated user. The key is only shown in this response.
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	userInfo, err := helper.GetUserInfoFromContext(c)
+	if err != nil {
+		response.ApiError(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	req, err := helper.GetValidatedFromContext[validation.CreateAPIKeyRequest](c)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var keyCount int64
+	if err := h.db.DB().Model(&model.APIKey{}).Where("user_id = ?", userInfo.ID).Count(&keyCount).Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to fetch API keys", err.Error())
+		return
+	}
+	if keyCount >= helper.GetEnvInt64("API_KEY_MAX_PER_USER", 20) {
+		response.ApiError(c, http.StatusConflict, "API key limit reached, delete an unused key first")
+		return
+	}
+
+	// Generate the key, only its hash is stored
+	apiKey := model.APIKeyPrefix + helper.GenerateRandomString(40)
+	record := model.APIKey{
+		UserID:  userInfo.ID,
+		Name:    req.Name,
+		KeyHash: helper.HashToken(apiKey),
+		Prefix:  apiKey[:len(model.APIKeyPrefix)+8],
+		Scopes:  joinScopes(req.Scopes),
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		record.ExpiresAt = &expiresAt
+	}
+	if err := h.db.DB().Create(&record).Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to create API key", err.Error())
+		return
+	}
+	audit.Record(c, h.db.DB(), audit.Event{
+		Action:   model.AuditAPIKeyCreated,
+		Metadata: map[string]interface{}{"api_key_id": record.ID, "prefix": record.Prefix, "scopes": req.Scopes},
+	})
+
+	response.SendResponse(c, http.StatusCreated, true, "API key created, copy it now since it won't be shown again", gin.H{
+		"api_key": apiKey,
+		"key":     record,
+	}, nil)
+}
+
+// GetAPIKeys lists the API keys of the authenticated user
+func (h *APIKeyHandler) GetAPIKeys(c *gin.Context) {
+	userInfo, err := helper.GetUserInfoFromContext(c)
+	if err != nil {
+		response.ApiError(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	var keys []model.APIKey
+	if err := h.db.DB().Where("user_id = ?", userInfo.ID).Order("created_at DESC").Find(&keys).Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to fetch API keys", err.Error())
+		return
+	}
+
+	response.SendResponse(c, http.StatusOK, true, "API keys fetched successfully", keys, nil)
+}
+
+// GetAPIKey returns one API key of the authenticated user
+func (h *APIKeyHandler) GetAPIKey(c *gin.Context) {
+	userInfo, err := helper.GetUserInfoFromContext(c)
+	if err != nil {
+		response.ApiError(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	var key model.APIKey
+	if err := h.db.DB().Where("id = ? AND user_id = ?", c.Param("id"), userInfo.ID).First(&key).Error; err != nil {
+		response.ApiError(c, http.StatusNotFound, "API key not found")
+		return
+	}
+
+	response.SendResponse(c, http.StatusOK, true, "API key fetched successfully", key, nil)
+}
+
+// UpdateAPIKey renames an API key or replaces its scopes
+func (h *APIKeyHandler) UpdateAPIKey(c *gin.Context) {
+	userInfo, err := helper.GetUserInfoFromContext(c)
+	if err != nil {
+		response.ApiError(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	req, err := helper.GetValidatedFromContext[validation.UpdateAPIKeyRequest](c)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var key model.APIKey
+	if err := h.db.DB().Where("id = ? AND user_id = ?", c.Param("id"), userInfo.ID).First(&key).Error; err != nil {
+		response.ApiError(c, http.StatusNotFound, "API key not found")
+		return
+	}
+
+	if req.Name != "" {
+		key.Name = req.Name
+	}
+	if len(req.Scopes) > 0 {
+		key.Scopes = joinScopes(req.Scopes)
+	}
+	if err := h.db.DB().Save(&key).Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to update API key", err.Error())
+		return
+	}
+
+	response.SendResponse(c, http.StatusOK, true, "API key updated successfully", key, nil)
+}
+
+// DeleteAPIKey revokes an API key of the authenticated user
+func (h *APIKeyHandler) DeleteAPIKey(c *gin.Context) {
+	userInfo, err := helper.GetUserInfoFromContext(c)
+	if err != nil {
+		response.ApiError(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	result := h.db.DB().Where("id = ? AND user_id = ?", c.Param("id"), userInfo.ID).Delete(&model.APIKey{})
+	if result.Error != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to delete API key", result.Error.Error())
+		return
+	}
+	if result.RowsAffected == 0 {
+		response.ApiError(c, http.StatusNotFound, "API key not found")
+		return
+	}
+	audit.Record(c, h.db.DB(), audit.Event{Action: model.AuditAPIKeyDeleted, Metadata: map[string]interface{}{"api_key_id": c.Param("id")}})
+
+	response.SendResponse[any](c, http.StatusOK, true, "API key deleted successfully", nil, nil)
+}
+
+// joinScopes stores scopes sorted and without duplicates
+func joinScopes(scopes []string) string {
+	scopes = slices.Clone(scopes)
+	slices.Sort(scopes)
+	return strings.Join(slices.Compact(scopes), ",")
+}
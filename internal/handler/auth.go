@@ -8,24 +8,34 @@ import (
 	"strconv"
 	"time"
 
+	"my-project/internal/audit"
 	"my-project/internal/database"
 	"my-project/internal/helper"
+	"my-project/internal/logger"
 	"my-project/internal/model"
 	"my-project/internal/oauth"
 	"my-project/internal/response"
+	"my-project/internal/sms"
+	"my-project/internal/token"
 	"my-project/internal/validation"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 type AuthHandler struct {
-	db database.Service
+	db        database.Service
+	tokens    token.Service
+	providers *oauth.Registry
+	sms       sms.Sender
+	login     loginPolicy
 }
 
-func NewAuthHandler(db database.Service) *AuthHandler {
-	return &AuthHandler{db: db}
+func NewAuthHandler(db database.Service, tokens token.Service, providers *oauth.Registry, sender sms.Sender) *AuthHandler {
+	return &AuthHandler{db: db, tokens: tokens, providers: providers, sms: sender, login: loginPolicyFromEnv()}
 }
 
 // HelloAuth handles the GET request for auth root endpoint
@@ -54,6 +64,17 @@ func (h *AuthHandler) SignUp(c *gin.Context) {
 		return
 	}
 
+	// The email stays reserved by a deleted account until it is purged, so it can still be restored
+	pendingDeletion, err := emailPendingDeletion(h.db.DB(), req.Email)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to check email", err.Error())
+		return
+	}
+	if pendingDeletion {
+		response.ApiError(c, http.StatusConflict, pendingDeletionMessage)
+		return
+	}
+
 	// Hash the password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -73,26 +94,32 @@ func (h *AuthHandler) SignUp(c *gin.Context) {
 		response.ApiError(c, http.StatusInternalServerError, "Failed to registered new user", err.Error())
 		return
 	}
+	audit.Record(c, h.db.DB(), audit.Event{Action: model.AuditSignUp, ActorID: user.ID, Metadata: map[string]interface{}{"method": "password"}})
 
-	// Generate email verification token
-	expiresInStr := os.Getenv("JWT_EMAIL_VERIFY_EXPIRES_IN")
-	expiresIn, err := strconv.ParseInt(expiresInStr, 10, 64)
-	if err != nil {
-		response.ApiError(c, http.StatusInternalServerError, "Invalid JWT_EMAIL_VERIFY_EXPIRES_IN value", err.Error())
-		return
+	// Send verification email
+	if err := h.sendVerificationEmail(user); err != nil {
+		log.Print("Failed to send verification email", err.Error())
+	}
+
+	// Send success response
+	response.SendResponse(c, http.StatusCreated, true, "User registered successfully", gin.H{
+		"user_id": user.ID,
+	}, nil)
+}
+
+// sendVerificationEmail issues an email verification token, emails it to the user and records the send
+func (h *AuthHandler) sendVerificationEmail(user *model.User) error {
+	// Record the send first so failed attempts still count towards the throttle
+	if err := h.db.DB().Create(&model.VerificationEmail{UserID: &user.ID, Email: user.Email}).Error; err != nil {
+		return fmt.Errorf("failed to record verification email: %w", err)
 	}
-	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id":    user.ID,
-		"email": user.Email,
-		"role":  user.Role,
-		"exp":   time.Now().Add(time.Second * time.Duration(expiresIn)).Unix(),
-	}).SignedString([]byte(os.Getenv("JWT_VERIFY_EMAIL_SECRET")))
+
+	// Generate email verification token
+	verifyToken, _, err := h.tokens.Issue(token.EmailVerify, subjectFromUser(user))
 	if err != nil {
-		response.ApiError(c, http.StatusInternalServerError, "Failed to generate verification token", err.Error())
-		return
+		return fmt.Errorf("failed to generate verification token: %w", err)
 	}
 
-	//Send verification email
 	clientURL := os.Getenv("ADMIN_CLIENT_URL")
 	emailBody := fmt.Sprintf(`
 		<div>
@@ -107,47 +134,80 @@ func (h *AuthHandler) SignUp(c *gin.Context) {
 			<p>If you didn't create this account, you can ignore this email.</p>
 			<p>Thank you, <br> E-Commerce</p>
 		</div>`,
-		user.Name, clientURL, token)
+		user.Name, clientURL, verifyToken)
 
-	if err := helper.SendEmail(user.Email, emailBody, "Verify Your Email"); err != nil {
-		// response.ApiError(c, http.StatusInternalServerError, "Failed to send verification email", err.Error())
-		// return
-		log.Print("Failed to send verification email", err.Error())
+	return helper.SendEmail(user.Email, emailBody, "Verify Your Email")
+}
+
+// ResendVerification sends a fresh verification email, throttled per email address
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	req, err := helper.GetValidatedFromContext[validation.ResendVerificationRequest](c)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, err.Error())
+		return
 	}
 
-	// Send success response
-	response.SendResponse(c, http.StatusCreated, true, "User registered successfully", gin.H{
-		"user_id": user.ID,
-	}, nil)
+	// Same answer for unknown and already verified addresses to avoid account discovery
+	successMessage := "If this email belongs to an unverified account, a new verification link has been sent"
+
+	// Enforce cooldown between sends
+	cooldown := time.Second * time.Duration(helper.GetEnvInt64("VERIFY_EMAIL_RESEND_COOLDOWN", 60))
+	var lastSend model.VerificationEmail
+	if err := h.db.DB().Where("email = ?", req.Email).Order("created_at DESC").First(&lastSend).Error; err == nil {
+		if retryAfter := time.Until(lastSend.CreatedAt.Add(cooldown)); retryAfter > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			response.ApiError(c, http.StatusTooManyRequests, "Please wait before requesting another verification email")
+			return
+		}
+	}
+
+	// Enforce daily cap
+	var sentToday int64
+	if err := h.db.DB().Model(&model.VerificationEmail{}).Where("email = ? AND created_at > ?", req.Email, time.Now().Add(-24*time.Hour)).Count(&sentToday).Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to check verification email history", err.Error())
+		return
+	}
+	if sentToday >= helper.GetEnvInt64("VERIFY_EMAIL_DAILY_LIMIT", 5) {
+		response.ApiError(c, http.StatusTooManyRequests, "Daily limit for verification emails reached, try again tomorrow")
+		return
+	}
+
+	// Requests for unknown and verified addresses count towards the throttle too,
+	// otherwise only real unverified accounts would ever answer with 429
+	var user model.User
+	if err := h.db.DB().Where("email = ?", req.Email).First(&user).Error; err != nil || user.IsVerified {
+		if err := h.db.DB().Create(&model.VerificationEmail{Email: req.Email}).Error; err != nil {
+			response.ApiError(c, http.StatusInternalServerError, "Failed to record verification email", err.Error())
+			return
+		}
+		response.SendResponse[any](c, http.StatusOK, true, successMessage, nil, nil)
+		return
+	}
+
+	if err := h.sendVerificationEmail(&user); err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to send verification email", err.Error())
+		return
+	}
+
+	response.SendResponse[any](c, http.StatusOK, true, successMessage, nil, nil)
 }
 
 // VerifyEmail handles email verification
 func (h *AuthHandler) VerifyEmail(c *gin.Context) {
-	token := c.Param("token")
+	verifyToken := c.Param("token")
 
-	if token == "" {
+	if verifyToken == "" {
 		response.ApiError(c, http.StatusBadRequest, "Verification token is required")
 		return
 	}
 
 	// Parse and validate the token
-	claims := jwt.MapClaims{}
-	t, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("JWT_VERIFY_EMAIL_SECRET")), nil
-	})
-	if err != nil || !t.Valid {
-
+	claims, err := h.tokens.Verify(token.EmailVerify, verifyToken)
+	if err != nil {
 		response.ApiError(c, http.StatusBadRequest, "Invalid or expired verification token")
 		return
 	}
-
-	// Extract user ID from the token
-	idFloat, ok := claims["id"].(float64)
-	if !ok {
-		response.ApiError(c, http.StatusBadRequest, "Invalid token payload")
-		return
-	}
-	userID := uint(idFloat)
+	userID := claims.ID
 
 	// Update user's email_verified_at field
 	if err := h.db.DB().Model(&model.User{}).Where("id = ?", uint(userID)).Update("is_verified", true).Error; err != nil {
@@ -174,78 +234,323 @@ func (h *AuthHandler) SignIn(c *gin.Context) {
 		return
 	}
 
-	// Find user in database
+	// Refuse attempts while the account or IP is locked out or still has to wait
+	if !h.allowSignInAttempt(c, req.Email) {
+		return
+	}
+
+	// Find user in database, unknown emails still pay for a bcrypt comparison
 	var user model.User
 	if err := h.db.DB().Where("email =?", req.Email).First(&user).Error; err != nil {
-		response.ApiError(c, http.StatusNotFound, "User doesn't exist.")
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(req.Password))
+		h.rejectSignIn(c, req.Email, nil)
 		return
 	}
-	//check user is verified or not
+
+	// Verify password using bcrypt
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		h.rejectSignIn(c, req.Email, &user)
+		return
+	}
+
+	// Disabled and banned accounts can't sign in, only revealed to callers who know the password
+	if !allowAccountStatus(c, &user) {
+		return
+	}
+
+	//check user is verified or not, only revealed to callers who know the password
 	if user.IsVerified == false {
 		response.ApiError(c, http.StatusForbidden, "Please verify your email before signing in.")
 		return
 	}
 
-	// Verify password using bcrypt
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		response.ApiError(c, http.StatusUnauthorized, "Password is incorrect.")
+	// With two-factor authentication enabled the password only earns a challenge
+	mfaEnabled, err := hasMfaEnabled(h.db.DB(), user.ID)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to check two-factor settings", err.Error())
+		return
+	}
+	if mfaEnabled {
+		h.sendMfaChallenge(c, &user)
+		return
+	}
+
+	if err := clearLoginFailures(h.db.DB(), user.Email); err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to reset sign in attempts", err.Error())
 		return
 	}
 
-	// Generate Access Token
-	accessExpiresInStr := os.Getenv("JWT_ACCESS_TOKEN_EXPIRES_IN")
-	accessExpiresIn, err := strconv.ParseInt(accessExpiresInStr, 10, 64)
+	// Start a new session
+	accessToken, err := issueSession(c, h.db.DB(), h.tokens, &user)
 	if err != nil {
-		response.ApiError(c, http.StatusInternalServerError, "Invalid JWT_ACCESS_TOKEN_EXPIRES_IN value", err.Error())
+		response.ApiError(c, http.StatusInternalServerError, "Failed to create session", err.Error())
 		return
 	}
 
-	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id":    user.ID,
-		"email": user.Email,
-		"role":  user.Role,
-		"exp":   time.Now().Add(time.Second * time.Duration(accessExpiresIn)).Unix(),
-	}).SignedString([]byte(os.Getenv("JWT_ACCESS_TOKEN_SECRET")))
+	// Send success response with tokens
+	response.SendResponse(c, http.StatusOK, true, "Sign in successful", gin.H{
+		"access_token": accessToken,
+	}, nil)
+}
+
+// sendMfaChallenge answers a successful first factor with a short-lived challenge token
+func (h *AuthHandler) sendMfaChallenge(c *gin.Context, user *model.User) {
+	mfaToken, _, err := h.tokens.Issue(token.MfaChallenge, subjectFromUser(user))
 	if err != nil {
-		response.ApiError(c, http.StatusInternalServerError, "Failed to generate access token", err.Error())
+		response.ApiError(c, http.StatusInternalServerError, "Failed to generate two-factor challenge", err.Error())
+		return
+	}
+
+	response.SendResponse(c, http.StatusOK, true, "Two-factor authentication required", gin.H{
+		"mfa_required": true,
+		"mfa_token":    mfaToken,
+	}, nil)
+}
+
+// claimUnverifiedAccount is used when someone just proved owning the email of an unverified account, which
+// may have been registered by someone else waiting for the owner to show up. It verifies the account, replaces
+// the unproven password with a random one emailed to the owner and ends every session started with the old one.
+func claimUnverifiedAccount(tx *gorm.DB, user *model.User, via string) error {
+	password := helper.GenerateRandomString(12)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	user.IsVerified = true
+	user.Password = string(hashedPassword)
+	user.HasTemporaryPassword = true
+	if err := tx.Model(user).Updates(map[string]interface{}{
+		"is_verified":            true,
+		"password":               user.Password,
+		"has_temporary_password": true,
+	}).Error; err != nil {
+		return err
+	}
+	if err := signOutEverywhere(tx, user.ID); err != nil {
+		return err
+	}
+
+	emailBody := fmt.Sprintf(`
+		<div>
+			<p>Hi, %s</p>
+			<p>You signed in with %s, which confirmed your email address and verified your account.</p>
+			<p>Any password set before has been replaced. Your temporary password is: <strong>%s</strong></p>
+			<p>Please change your password after signing in for security.</p>
+			<p>Thank you, <br> E-Commerce</p>
+		</div>`,
+		user.Name, via, password)
+
+	if err := helper.SendEmail(user.Email, emailBody, "Your E-Commerce Account Password"); err != nil {
+		log.Print("Failed to send password email", err.Error())
+	}
+	return nil
+}
+
+// completeSignIn answers a finished sign-in with tokens, or with an MFA challenge when the user enabled two-factor authentication
+func (h *AuthHandler) completeSignIn(c *gin.Context, user *model.User, message string) {
+	if !allowAccountStatus(c, user) {
+		return
+	}
+
+	// AuthMiddleware refuses unverified accounts, so there is no point in handing them tokens
+	if !user.IsVerified {
+		response.ApiError(c, http.StatusForbidden, "Please verify your email before signing in.")
 		return
 	}
 
-	// Generate Refresh Token
-	refreshExpiresInStr := os.Getenv("JWT_REFRESH_TOKEN_EXPIRES_IN")
-	refreshExpiresIn, err := strconv.ParseInt(refreshExpiresInStr, 10, 64)
+	// Two-factor users still have to pass the second factor
+	mfaEnabled, err := hasMfaEnabled(h.db.DB(), user.ID)
 	if err != nil {
-		response.ApiError(c, http.StatusInternalServerError, "Invalid JWT_REFRESH_TOKEN_EXPIRES_IN value", err.Error())
+		response.ApiError(c, http.StatusInternalServerError, "Failed to check two-factor settings", err.Error())
 		return
 	}
-	refreshToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id":    user.ID,
-		"email": user.Email,
-		"role":  user.Role,
-		"exp":   time.Now().Add(time.Second * time.Duration(refreshExpiresIn)).Unix(),
-	}).SignedString([]byte(os.Getenv("JWT_REFRESH_TOKEN_SECRET")))
+	if mfaEnabled {
+		h.sendMfaChallenge(c, user)
+		return
+	}
+
+	// Start a new session
+	accessToken, err := issueSession(c, h.db.DB(), h.tokens, user)
 	if err != nil {
-		response.ApiError(c, http.StatusInternalServerError, "Failed to generate refresh token", err.Error())
+		response.ApiError(c, http.StatusInternalServerError, "Failed to create session", err.Error())
 		return
 	}
 
-	// Create a new refresh token record
-	refreshTokenRecord := &model.RefreshToken{
-		Token:     refreshToken,
-		UserID:    user.ID,
-		ExpiresAt: time.Now().Add(time.Second * time.Duration(refreshExpiresIn)),
+	response.SendResponse(c, http.StatusOK, true, message, gin.H{
+		"access_token": accessToken,
+		"user_id":      user.ID,
+	}, nil)
+}
+
+// pendingDeletionMessage answers sign ups with the email of a deleted account that isn't purged yet
+const pendingDeletionMessage = "An account with this email is pending deletion, contact support to restore it"
+
+// emailPendingDeletion reports whether a deleted account still holds the email until it is purged
+func emailPendingDeletion(db *gorm.DB, email string) (bool, error) {
+	var count int64
+	err := db.Unscoped().Model(&model.User{}).Where("email = ? AND deleted_at IS NOT NULL", email).Count(&count).Error
+	return count > 0, err
+}
+
+// allowAccountStatus answers with 403 and returns false when an admin disabled or banned the account
+func allowAccountStatus(c *gin.Context, user *model.User) bool {
+	switch user.Status {
+	case model.UserDisabled:
+		response.ApiError(c, http.StatusForbidden, "This account has been disabled", user.StatusReason)
+		return false
+	case model.UserBanned:
+		response.ApiError(c, http.StatusForbidden, "This account has been banned", user.StatusReason)
+		return false
+	}
+	return true
+}
+
+// allowSignInAttempt answers with 429 and returns false while the email or IP has to wait
+func (h *AuthHandler) allowSignInAttempt(c *gin.Context, email string) bool {
+	retryAfter, err := loginRetryAfter(h.db.DB(), h.login, email, c.ClientIP())
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to check sign in attempts", err.Error())
+		return false
+	}
+	if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		response.ApiError(c, http.StatusTooManyRequests, "Too many failed sign in attempts, please try again later")
+		return false
+	}
+	return true
+}
+
+// rejectSignIn records the failure and answers the same way for unknown emails and wrong passwords
+func (h *AuthHandler) rejectSignIn(c *gin.Context, email string, user *model.User) {
+	h.recordSignInFailure(c, email, user)
+	response.ApiError(c, http.StatusUnauthorized, "Invalid email or password")
+}
+
+// recordSignInFailure stores a failed attempt and emails an unlock link when it locks an existing account
+func (h *AuthHandler) recordSignInFailure(c *gin.Context, email string, user *model.User) {
+	event := audit.Event{Action: model.AuditSignInFailed, Email: email, Metadata: map[string]interface{}{"route": c.FullPath()}}
+	if user != nil {
+		event.TargetID = user.ID
 	}
+	audit.Record(c, h.db.DB(), event)
 
-	// Save refresh token to database
-	if err := h.db.DB().Create(refreshTokenRecord).Error; err != nil {
-		response.ApiError(c, http.StatusInternalServerError, "Failed to save refresh token", err.Error())
+	locked, err := recordLoginFailure(h.db.DB(), h.login, email, c.ClientIP())
+	if err != nil {
+		logger.ErrorLogger.Error("Failed to record failed sign in", zap.Error(err), zap.String("email", email))
+		return
+	}
+	if !locked {
 		return
 	}
 
-	// Set refresh token in cookies
-	c.SetCookie("GO_JWT", refreshToken, int(refreshExpiresIn), "/", "", false, true)
+	logAccountLocked(email, c.ClientIP(), c.Request.UserAgent())
+	event.Action = model.AuditAccountLocked
+	audit.Record(c, h.db.DB(), event)
+	if user != nil {
+		if err := sendUnlockEmail(h.db.DB(), user); err != nil {
+			log.Print("Failed to send unlock email", err.Error())
+		}
+	}
+}
+
+// UnlockAccount lifts a sign-in lockout using the token from the unlock email
+func (h *AuthHandler) UnlockAccount(c *gin.Context) {
+	req, err := helper.GetValidatedFromContext[validation.UnlockAccountRequest](c)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var unlockTokenRecord model.AccountUnlockToken
+	if err := h.db.DB().Preload("User").Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", helper.HashToken(req.Token), time.Now()).First(&unlockTokenRecord).Error; err != nil {
+		response.ApiError(c, http.StatusBadRequest, "Invalid or expired unlock token")
+		return
+	}
+
+	tx := h.db.DB().Begin()
+
+	// Mark the token as used, the condition guards against concurrent use of the same token
+	result := tx.Model(&model.AccountUnlockToken{}).Where("id = ? AND used_at IS NULL", unlockTokenRecord.ID).Update("used_at", time.Now())
+	if result.Error != nil {
+		tx.Rollback()
+		response.ApiError(c, http.StatusInternalServerError, "Failed to unlock account", result.Error.Error())
+		return
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		response.ApiError(c, http.StatusBadRequest, "Invalid or expired unlock token")
+		return
+	}
+
+	if err := clearLoginFailures(tx, unlockTokenRecord.User.Email); err != nil {
+		tx.Rollback()
+		response.ApiError(c, http.StatusInternalServerError, "Failed to unlock account", err.Error())
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to commit transaction", err.Error())
+		return
+	}
+
+	response.SendResponse(c, http.StatusOK, true, "Account unlocked, you can sign in again", gin.H{
+		"user_id": unlockTokenRecord.UserID,
+	}, nil)
+}
+
+// VerifyMfa completes a sign-in by checking the second factor against the challenge token
+func (h *AuthHandler) VerifyMfa(c *gin.Context) {
+	req, err := helper.GetValidatedFromContext[validation.MfaVerifyRequest](c)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	claims, err := h.tokens.Verify(token.MfaChallenge, req.MfaToken)
+	if err != nil {
+		response.ApiError(c, http.StatusUnauthorized, "Invalid or expired two-factor challenge, please sign in again")
+		return
+	}
+
+	var user model.User
+	if err := h.db.DB().First(&user, claims.ID).Error; err != nil {
+		response.ApiError(c, http.StatusUnauthorized, "Invalid or expired two-factor challenge, please sign in again")
+		return
+	}
+
+	// Code guesses count towards the same lockout as password guesses
+	if !h.allowSignInAttempt(c, user.Email) {
+		return
+	}
+
+	valid, err := verifySecondFactor(h.db.DB(), user.ID, req.Code, req.RecoveryCode)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to verify authentication code", err.Error())
+		return
+	}
+	if !valid {
+		h.recordSignInFailure(c, user.Email, &user)
+		response.ApiError(c, http.StatusUnauthorized, "Invalid authentication code")
+		return
+	}
+
+	if !allowAccountStatus(c, &user) {
+		return
+	}
+
+	if err := clearLoginFailures(h.db.DB(), user.Email); err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to reset sign in attempts", err.Error())
+		return
+	}
+
+	// Start a new session
+	accessToken, err := issueSession(c, h.db.DB(), h.tokens, &user)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to create session", err.Error())
+		return
+	}
 
-	// Send success response with tokens
 	response.SendResponse(c, http.StatusOK, true, "Sign in successful", gin.H{
 		"access_token": accessToken,
 	}, nil)
@@ -261,80 +566,98 @@ func (h *AuthHandler) UpdateToken(c *gin.Context) {
 	}
 
 	// Verify refresh token
-	claims := jwt.MapClaims{}
-	t, err := jwt.ParseWithClaims(refreshToken, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("JWT_REFRESH_TOKEN_SECRET")), nil
-
-	})
-	if err != nil || !t.Valid {
+	claims, err := h.tokens.Verify(token.Refresh, refreshToken)
+	if err != nil {
 		response.ApiError(c, http.StatusBadRequest, "Invalid or expired refresh token")
 		return
 	}
-
-	// Extract user ID from the token
-	idFloat, ok := claims["id"].(float64)
-	if !ok {
-		response.ApiError(c, http.StatusBadRequest, "Invalid token payload")
-		return
-	}
-	userID := uint(idFloat)
+	userID := claims.ID
 
 	// Check if the refresh token exists and belongs to the user
 	var refreshTokenRecord model.RefreshToken
-	if err := h.db.DB().Where("token = ? AND user_id = ?", refreshToken, userID).First(&refreshTokenRecord).Error; err != nil {
+	if err := h.db.DB().Where("token_hash = ? AND user_id = ?", helper.HashToken(refreshToken), userID).First(&refreshTokenRecord).Error; err != nil {
 		response.ApiError(c, http.StatusBadRequest, "Invalid or expired refresh token")
 		return
 	}
 
+	// A used token being presented again means it was leaked, revoke the whole family
+	if refreshTokenRecord.UsedAt != nil {
+		h.revokeRefreshTokenFamily(c, &refreshTokenRecord)
+		response.ApiError(c, http.StatusUnauthorized, "Refresh token reuse detected, please sign in again")
+		return
+	}
+
 	// Check if the refresh token is valid
 	if refreshTokenRecord.ExpiresAt.Before(time.Now()) {
 		response.ApiError(c, http.StatusBadRequest, "Invalid or expired refresh token")
 		return
 	}
-	// Generate new access token
-	accessExpiresInStr := os.Getenv("JWT_ACCESS_TOKEN_EXPIRES_IN")
-	accessExpiresIn, err := strconv.ParseInt(accessExpiresInStr, 10, 64)
-	if err != nil {
-		response.ApiError(c, http.StatusInternalServerError, "Invalid JWT_ACCESS_TOKEN_EXPIRES_IN value", err.Error())
+	// Load the user so the new tokens carry the current email and role
+	var user model.User
+	if err := h.db.DB().First(&user, userID).Error; err != nil {
+		response.ApiError(c, http.StatusBadRequest, "Invalid or expired refresh token")
 		return
 	}
-	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id":    userID,
-		"email": claims["email"],
-		"role":  claims["role"],
-		"exp":   time.Now().Add(time.Second * time.Duration(accessExpiresIn)).Unix(),
-	}).SignedString([]byte(os.Getenv("JWT_ACCESS_TOKEN_SECRET")))
+	if !allowAccountStatus(c, &user) {
+		return
+	}
+
+	// Generate new access token
+	accessToken, _, err := h.tokens.Issue(token.Access, subjectFromUser(&user))
 	if err != nil {
 		response.ApiError(c, http.StatusInternalServerError, "Failed to generate access token", err.Error())
 		return
 	}
 
 	//generate new refresh token
-	refreshExpiresInStr := os.Getenv("JWT_REFRESH_TOKEN_EXPIRES_IN")
-	refreshExpiresIn, err := strconv.ParseInt(refreshExpiresInStr, 10, 64)
+	refreshToken, refreshClaims, err := h.tokens.Issue(token.Refresh, subjectFromUser(&user))
 	if err != nil {
-		response.ApiError(c, http.StatusInternalServerError, "Invalid JWT_REFRESH_TOKEN_EXPIRES_IN value", err.Error())
+		response.ApiError(c, http.StatusInternalServerError, "Failed to generate refresh token", err.Error())
 		return
 	}
-	refreshToken, err = jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id":    userID,
-		"email": claims["email"],
-		"role":  claims["role"],
-		"exp":   time.Now().Add(time.Second * time.Duration(refreshExpiresIn)).Unix(),
-	}).SignedString([]byte(os.Getenv("JWT_REFRESH_TOKEN_SECRET")))
-	if err != nil {
-		response.ApiError(c, http.StatusInternalServerError, "Failed to generate refresh token", err.Error())
+	// Rotate: mark the presented token as used and add its successor to the family
+	tx := h.db.DB().Begin()
+	result := tx.Model(&model.RefreshToken{}).Where("id = ? AND used_at IS NULL", refreshTokenRecord.ID).Update("used_at", time.Now())
+	if result.Error != nil {
+		tx.Rollback()
+		response.ApiError(c, http.StatusInternalServerError, "Failed to update refresh token", result.Error.Error())
+		return
+	}
+	if result.RowsAffected == 0 {
+		// Another request rotated this token in the meantime
+		tx.Rollback()
+		h.revokeRefreshTokenFamily(c, &refreshTokenRecord)
+		response.ApiError(c, http.StatusUnauthorized, "Refresh token reuse detected, please sign in again")
+		return
+	}
+	newRefreshTokenRecord := &model.RefreshToken{
+		TokenHash: helper.HashToken(refreshToken),
+		UserID:    userID,
+		FamilyID:  refreshTokenRecord.FamilyID,
+		ParentID:  &refreshTokenRecord.ID,
+		CreatedAt: refreshTokenRecord.CreatedAt,
+		ExpiresAt: refreshClaims.ExpiresAt.Time,
+	}
+	setSessionMetadata(c, newRefreshTokenRecord)
+	if err := tx.Create(newRefreshTokenRecord).Error; err != nil {
+		tx.Rollback()
+		response.ApiError(c, http.StatusInternalServerError, "Failed to update refresh token", err.Error())
 		return
 	}
-	// Update the refresh token in the database
-	refreshTokenRecord.Token = refreshToken
-	refreshTokenRecord.ExpiresAt = time.Now().Add(time.Second * time.Duration(refreshExpiresIn))
-	if err := h.db.DB().Save(&refreshTokenRecord).Error; err != nil {
+	// Drop expired tokens of the user, they are no longer needed for reuse detection
+	if err := tx.Where("user_id = ? AND expires_at < ?", userID, time.Now()).Delete(&model.RefreshToken{}).Error; err != nil {
+		tx.Rollback()
 		response.ApiError(c, http.StatusInternalServerError, "Failed to update refresh token", err.Error())
 		return
 	}
+	if err := tx.Commit().Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to commit transaction", err.Error())
+		return
+	}
+	audit.Record(c, h.db.DB(), audit.Event{Action: model.AuditTokenRefreshed, ActorID: userID, Metadata: map[string]interface{}{"family_id": refreshTokenRecord.FamilyID}})
+
 	// Set refresh token in cookies
-	c.SetCookie("GO_JWT", refreshToken, int(refreshExpiresIn), "/", "", false, true)
+	setRefreshTokenCookie(c, refreshToken, refreshClaims.ExpiresAt.Time)
 
 	// Send success response with tokens
 	response.SendResponse(c, http.StatusOK, true, "Token updated successfully", gin.H{
@@ -353,33 +676,25 @@ func (h *AuthHandler) SignOut(c *gin.Context) {
 	}
 
 	// Verify refresh token
-	claims := jwt.MapClaims{}
-	t, err := jwt.ParseWithClaims(refreshToken, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("JWT_REFRESH_TOKEN_SECRET")), nil
-
-	})
-	if err != nil || !t.Valid {
+	claims, err := h.tokens.Verify(token.Refresh, refreshToken)
+	if err != nil {
 		response.ApiError(c, http.StatusBadRequest, "Invalid or expired refresh token")
 		return
 	}
+	userID := claims.ID
 
-	// Extract user ID from the token
-	idFloat, ok := claims["id"].(float64)
-	if !ok {
-		response.ApiError(c, http.StatusBadRequest, "Invalid token payload")
-		return
-	}
-	userID := uint(idFloat)
-
-	// Delete the specific refresh token for this user from the database
-	if err := h.db.DB().Where("token = ? AND user_id = ?", refreshToken, userID).Delete(&model.RefreshToken{}).Error; err != nil {
-		response.ApiError(c, http.StatusInternalServerError, "Failed to sign out", err.Error())
-		return
+	// Delete the session's refresh token family for this user from the database
+	var refreshTokenRecord model.RefreshToken
+	if err := h.db.DB().Where("token_hash = ? AND user_id = ?", helper.HashToken(refreshToken), userID).First(&refreshTokenRecord).Error; err == nil {
+		if err := h.db.DB().Where("family_id = ? AND user_id = ?", refreshTokenRecord.FamilyID, userID).Delete(&model.RefreshToken{}).Error; err != nil {
+			response.ApiError(c, http.StatusInternalServerError, "Failed to sign out", err.Error())
+			return
+		}
 	}
 
 	// Clear the refresh token cookie
-	c.SetCookie("GO_JWT", "", -1, "/", "", false, true)
-	fmt.Println("Sign out successful")
+	clearRefreshTokenCookie(c)
+	audit.Record(c, h.db.DB(), audit.Event{Action: model.AuditSignOut, ActorID: userID})
 
 	// Send success response
 	response.SendResponse(c, http.StatusOK, true, "Sign out successful", gin.H{
@@ -387,191 +702,240 @@ func (h *AuthHandler) SignOut(c *gin.Context) {
 	}, nil)
 }
 
-// GoogleSignIn initiates the Google OAuth2 flow
-func (h *AuthHandler) GoogleSignIn(c *gin.Context) {
-	// Generate random state
-	state := helper.GenerateRandomString(32)
+// subjectFromUser builds the token subject for a user
+func subjectFromUser(user *model.User) token.Subject {
+	return token.Subject{
+		ID:    user.ID,
+		Email: user.Email,
+		Role:  string(user.Role),
+	}
+}
+
+// issueSession starts a new session for the user: it stores a new refresh token family
+// through db (which may be a transaction), sets the refresh cookie and returns an access token
+func issueSession(c *gin.Context, db *gorm.DB, tokens token.Issuer, user *model.User) (string, error) {
+	accessToken, _, err := tokens.Issue(token.Access, subjectFromUser(user))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate access token: %w", err)
+	}
+
+	refreshToken, refreshClaims, err := tokens.Issue(token.Refresh, subjectFromUser(user))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	refreshTokenRecord := &model.RefreshToken{
+		TokenHash: helper.HashToken(refreshToken),
+		UserID:    user.ID,
+		FamilyID:  uuid.New().String(),
+		ExpiresAt: refreshClaims.ExpiresAt.Time,
+	}
+	setSessionMetadata(c, refreshTokenRecord)
+
+	if err := db.Create(refreshTokenRecord).Error; err != nil {
+		return "", fmt.Errorf("failed to save refresh token: %w", err)
+	}
 
-	// Store state in cookie
-	c.SetCookie("oauth_state", state, 600, "/", "", false, true)
+	setRefreshTokenCookie(c, refreshToken, refreshClaims.ExpiresAt.Time)
+	audit.Record(c, db, audit.Event{Action: model.AuditSignIn, ActorID: user.ID, Metadata: map[string]interface{}{"route": c.FullPath()}})
+	return accessToken, nil
+}
 
-	// Get Google OAuth config
-	googleConfig := oauth.GoogleOAuthConfig()
+// setRefreshTokenCookie stores the refresh token in an http-only cookie that lives as long as the token
+func setRefreshTokenCookie(c *gin.Context, refreshToken string, expiresAt time.Time) {
+	c.SetCookie("GO_JWT", refreshToken, int(time.Until(expiresAt).Seconds()), "/", "", false, true)
+}
 
-	// Redirect to Google's consent page
-	url := googleConfig.AuthCodeURL(state)
-	fmt.Println("Redirecting to Google OAuth2 consent page...", url)
-	c.Redirect(http.StatusTemporaryRedirect, url)
+// clearRefreshTokenCookie removes the refresh token cookie
+func clearRefreshTokenCookie(c *gin.Context) {
+	c.SetCookie("GO_JWT", "", -1, "/", "", false, true)
 }
 
-// GoogleCallback handles the callback from Google
-func (h *AuthHandler) GoogleCallback(c *gin.Context) {
-	// Get state from cookie
-	state, err := c.Cookie("oauth_state")
+// setSessionMetadata stores where a refresh token is being used from
+func setSessionMetadata(c *gin.Context, refreshTokenRecord *model.RefreshToken) {
+	now := time.Now()
+	userAgent := c.Request.UserAgent()
+	refreshTokenRecord.UserAgent = helper.TruncateString(userAgent, 512)
+	refreshTokenRecord.IP = c.ClientIP()
+	refreshTokenRecord.DeviceLabel = helper.DeviceLabel(userAgent)
+	refreshTokenRecord.LastUsedAt = &now
+}
+
+// SignOutAll revokes every session of the authenticated user
+func (h *AuthHandler) SignOutAll(c *gin.Context) {
+	userInfo, err := helper.GetUserInfoFromContext(c)
 	if err != nil {
-		response.ApiError(c, http.StatusBadRequest, "State cookie not found")
+		response.ApiError(c, http.StatusUnauthorized, err.Error())
 		return
 	}
 
-	// Verify state
-	if state != c.Query("state") {
-		response.ApiError(c, http.StatusBadRequest, "Invalid state parameter")
+	result := h.db.DB().Where("user_id = ?", userInfo.ID).Delete(&model.RefreshToken{})
+	if result.Error != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to sign out", result.Error.Error())
 		return
 	}
 
-	// Exchange code for token
-	code := c.Query("code")
-	googleConfig := oauth.GoogleOAuthConfig()
-	token, err := googleConfig.Exchange(c, code)
-	if err != nil {
-		response.ApiError(c, http.StatusInternalServerError, "Failed to exchange token", err.Error())
-		return
+	// Clear the refresh token cookie
+	clearRefreshTokenCookie(c)
+	audit.Record(c, h.db.DB(), audit.Event{Action: model.AuditSignOutAll, Metadata: map[string]interface{}{"sessions": result.RowsAffected}})
+
+	response.SendResponse(c, http.StatusOK, true, "Signed out from all sessions", gin.H{
+		"user_id": userInfo.ID,
+	}, nil)
+}
+
+// revokeRefreshTokenFamily deletes every refresh token of a family and logs the reuse as a security event
+func (h *AuthHandler) revokeRefreshTokenFamily(c *gin.Context, refreshTokenRecord *model.RefreshToken) {
+	logger.ErrorLogger.Error("Security event: refresh token reuse detected",
+		zap.Uint("user_id", refreshTokenRecord.UserID),
+		zap.String("family_id", refreshTokenRecord.FamilyID),
+		zap.Uint("token_id", refreshTokenRecord.ID),
+		zap.String("ip", c.ClientIP()),
+		zap.String("user_agent", c.Request.UserAgent()),
+	)
+
+	audit.Record(c, h.db.DB(), audit.Event{
+		Action:   model.AuditRefreshTokenReused,
+		TargetID: refreshTokenRecord.UserID,
+		Metadata: map[string]interface{}{"family_id": refreshTokenRecord.FamilyID},
+	})
+
+	if err := h.db.DB().Where("family_id = ? AND user_id = ?", refreshTokenRecord.FamilyID, refreshTokenRecord.UserID).Delete(&model.RefreshToken{}).Error; err != nil {
+		logger.ErrorLogger.Error("Failed to revoke refresh token family",
+			zap.Error(err),
+			zap.String("family_id", refreshTokenRecord.FamilyID))
 	}
 
-	// Get user info from Google
-	googleUser, err := oauth.GetGoogleUser(token.AccessToken)
+	// Clear the refresh token cookie
+	clearRefreshTokenCookie(c)
+}
+
+// ForgotPassword emails a single-use password reset link to the user
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	req, err := helper.GetValidatedFromContext[validation.ForgotPasswordRequest](c)
 	if err != nil {
-		response.ApiError(c, http.StatusInternalServerError, "Failed to get user info from Google", err.Error())
+		response.ApiError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	// Start database transaction
-	tx := h.db.DB().Begin()
+	// Always answer the same way so the endpoint can't be used to discover accounts
+	successMessage := "If an account exists for this email, a password reset link has been sent"
 
-	// Check if user exists
 	var user model.User
-	if err := tx.Where("email = ?", googleUser.Email).First(&user).Error; err != nil {
-		// Generate random password for new user
-		password := helper.GenerateRandomString(12)
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-		if err != nil {
-			tx.Rollback()
-			response.ApiError(c, http.StatusInternalServerError, "Failed to hash password", err.Error())
-			return
-		}
+	if err := h.db.DB().Where("email = ?", req.Email).First(&user).Error; err != nil {
+		response.SendResponse[any](c, http.StatusOK, true, successMessage, nil, nil)
+		return
+	}
 
-		// Create new user if not exists
-		user = model.User{
-			Name:       googleUser.Name,
-			Email:      googleUser.Email,
-			Password:   string(hashedPassword),
-			IsVerified: true,
-			Role:       "user",
-		}
-		if err := tx.Create(&user).Error; err != nil {
-			tx.Rollback()
-			response.ApiError(c, http.StatusInternalServerError, "Failed to create user", err.Error())
-			return
-		}
+	// Invalidate any reset tokens that were issued before this one
+	if err := h.db.DB().Where("user_id = ? AND used_at IS NULL", user.ID).Delete(&model.PasswordResetToken{}).Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to create password reset token", err.Error())
+		return
+	}
 
-		// Send password via email
-		emailBody := fmt.Sprintf(`
-			<div>
-				<p>Hi, %s</p>
-				<p>Welcome to E-Commerce! Your account has been created with Google Sign-In.</p>
-				<p>Your temporary password is: <strong>%s</strong></p>
-				<p>Please change your password after signing in for security.</p>
-				<p>Thank you, <br> E-Commerce</p>
-			</div>`,
-			user.Name, password)
-
-		if err := helper.SendEmail(user.Email, emailBody, "Your E-Commerce Account Password"); err != nil {
-			log.Print("Failed to send password email", err.Error())
-		}
+	// Generate reset token, only its hash is stored
+	resetToken := helper.GenerateRandomString(48)
+	expiresIn := helper.GetEnvInt64("PASSWORD_RESET_EXPIRES_IN", 900)
+	resetTokenRecord := &model.PasswordResetToken{
+		TokenHash: helper.HashToken(resetToken),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(time.Second * time.Duration(expiresIn)),
+	}
+	if err := h.db.DB().Create(resetTokenRecord).Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to create password reset token", err.Error())
+		return
 	}
 
-	// Create or update social profile
-	var socialProfile model.SocialProfile
-	if err := tx.Where("user_id = ? AND provider = ?", user.ID, model.Google).First(&socialProfile).Error; err != nil {
-		// Create new social profile
-		socialProfile = model.SocialProfile{
-			UserID:     user.ID,
-			Provider:   model.Google,
-			ProviderID: googleUser.ID,
-			Name:       googleUser.Name,
-			PhotoURL:   googleUser.Picture,
-		}
-		if err := tx.Create(&socialProfile).Error; err != nil {
-			tx.Rollback()
-			response.ApiError(c, http.StatusInternalServerError, "Failed to create social profile", err.Error())
-			return
-		}
-	} else {
-		// Update existing social profile
-		socialProfile.Name = googleUser.Name
-		socialProfile.PhotoURL = googleUser.Picture
-		if err := tx.Save(&socialProfile).Error; err != nil {
-			tx.Rollback()
-			response.ApiError(c, http.StatusInternalServerError, "Failed to update social profile", err.Error())
-			return
-		}
+	// Send reset email
+	clientURL := os.Getenv("ADMIN_CLIENT_URL")
+	emailBody := fmt.Sprintf(`
+		<div>
+			<p>Hi, %s</p>
+			<p>We received a request to reset your password. Click the link below to choose a new one:</p>
+			<p>
+				<a href="%s/auth/reset-password?token=%s">
+					Reset Password
+				</a>
+			</p>
+			<p>This link will expire in %d minutes and can only be used once.</p>
+			<p>If you didn't request a password reset, you can ignore this email.</p>
+			<p>Thank you, <br> E-Commerce</p>
+		</div>`,
+		user.Name, clientURL, resetToken, expiresIn/60)
+
+	if err := helper.SendEmail(user.Email, emailBody, "Reset Your Password"); err != nil {
+		log.Print("Failed to send password reset email", err.Error())
 	}
 
-	// generate new refresh token
-	refreshExpiresInStr := os.Getenv("JWT_REFRESH_TOKEN_EXPIRES_IN")
-	refreshExpiresIn, err := strconv.ParseInt(refreshExpiresInStr, 10, 64)
+	response.SendResponse[any](c, http.StatusOK, true, successMessage, nil, nil)
+}
+
+// ResetPassword sets a new password using a reset token and revokes all sessions
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	req, err := helper.GetValidatedFromContext[validation.ResetPasswordRequest](c)
 	if err != nil {
-		tx.Rollback()
-		response.ApiError(c, http.StatusInternalServerError, "Invalid JWT_REFRESH_TOKEN_EXPIRES_IN value", err.Error())
+		response.ApiError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Find an unused, unexpired reset token
+	var resetTokenRecord model.PasswordResetToken
+	if err := h.db.DB().Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", helper.HashToken(req.Token), time.Now()).First(&resetTokenRecord).Error; err != nil {
+		response.ApiError(c, http.StatusBadRequest, "Invalid or expired reset token")
 		return
 	}
-	refreshToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id":    user.ID,
-		"email": user.Email,
-		"role":  user.Role,
-		"exp":   time.Now().Add(time.Second * time.Duration(refreshExpiresIn)).Unix(),
-	}).SignedString([]byte(os.Getenv("JWT_REFRESH_TOKEN_SECRET")))
+
+	// Hash the new password
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
-		tx.Rollback()
-		response.ApiError(c, http.StatusInternalServerError, "Failed to generate refresh token", err.Error())
+		response.ApiError(c, http.StatusInternalServerError, "Failed to hash password", err.Error())
 		return
 	}
 
-	// Create refresh token record
-	refreshTokenRecord := model.RefreshToken{
-		Token:     refreshToken,
-		UserID:    user.ID,
-		ExpiresAt: time.Now().Add(time.Second * time.Duration(refreshExpiresIn)),
+	tx := h.db.DB().Begin()
+
+	// Mark the token as used, the condition guards against concurrent use of the same token
+	result := tx.Model(&model.PasswordResetToken{}).Where("id = ? AND used_at IS NULL", resetTokenRecord.ID).Update("used_at", time.Now())
+	if result.Error != nil {
+		tx.Rollback()
+		response.ApiError(c, http.StatusInternalServerError, "Failed to reset password", result.Error.Error())
+		return
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		response.ApiError(c, http.StatusBadRequest, "Invalid or expired reset token")
+		return
 	}
 
-	// Save refresh token to database
-	if err := tx.Create(&refreshTokenRecord).Error; err != nil {
+	// Update password
+	if err := tx.Model(&model.User{}).Where("id = ?", resetTokenRecord.UserID).Updates(map[string]interface{}{"password": string(hashedPassword), "has_temporary_password": false}).Error; err != nil {
 		tx.Rollback()
-		response.ApiError(c, http.StatusInternalServerError, "Failed to save refresh token", err.Error())
+		response.ApiError(c, http.StatusInternalServerError, "Failed to reset password", err.Error())
 		return
 	}
 
-	// Set refresh token in cookies
-	c.SetCookie("GO_JWT", refreshToken, int(refreshExpiresIn), "/", "", false, true)
-	// Commit transaction
-	if err := tx.Commit().Error; err != nil {
-		response.ApiError(c, http.StatusInternalServerError, "Failed to commit transaction", err.Error())
+	// Revoke every session of the user
+	if err := tx.Where("user_id = ?", resetTokenRecord.UserID).Delete(&model.RefreshToken{}).Error; err != nil {
+		tx.Rollback()
+		response.ApiError(c, http.StatusInternalServerError, "Failed to revoke sessions", err.Error())
 		return
 	}
+	audit.Record(c, tx, audit.Event{Action: model.AuditPasswordReset, ActorID: resetTokenRecord.UserID})
 
-	// Generate  access token
-	accessExpiresInStr := os.Getenv("JWT_ACCESS_TOKEN_EXPIRES_IN")
-	accessExpiresIn, err := strconv.ParseInt(accessExpiresInStr, 10, 64)
-	if err != nil {
-		response.ApiError(c, http.StatusInternalServerError, "Invalid JWT_ACCESS_TOKEN_EXPIRES_IN value", err.Error())
+	// A new password also lifts any sign-in lockout
+	if err := tx.Where("email = (?)", tx.Model(&model.User{}).Select("email").Where("id = ?", resetTokenRecord.UserID)).Delete(&model.FailedLoginAttempt{}).Error; err != nil {
+		tx.Rollback()
+		response.ApiError(c, http.StatusInternalServerError, "Failed to reset sign in attempts", err.Error())
 		return
 	}
 
-	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id":    user.ID,
-		"email": user.Email,
-		"role":  user.Role,
-		"exp":   time.Now().Add(time.Second * time.Duration(accessExpiresIn)).Unix(),
-	}).SignedString([]byte(os.Getenv("JWT_ACCESS_TOKEN_SECRET")))
-	if err != nil {
-		response.ApiError(c, http.StatusInternalServerError, "Failed to generate access token", err.Error())
+	if err := tx.Commit().Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to commit transaction", err.Error())
 		return
 	}
 
-	// Send success response
-	response.SendResponse(c, http.StatusOK, true, "Google sign in successful", gin.H{
-		"access_token": accessToken,
-		"user_id":      user.ID,
+	response.SendResponse(c, http.StatusOK, true, "Password reset successfully", gin.H{
+		"user_id": resetTokenRecord.UserID,
 	}, nil)
 }
 
@@ -585,25 +949,16 @@ func (h *AuthHandler) UserDetails(c *gin.Context) {
 	}
 
 	// Verify refresh token
-	claims := jwt.MapClaims{}
-	t, err := jwt.ParseWithClaims(refreshToken, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("JWT_REFRESH_TOKEN_SECRET")), nil
-
-	})
-	if err != nil || !t.Valid {
+	claims, err := h.tokens.Verify(token.Refresh, refreshToken)
+	if err != nil {
 		response.ApiError(c, http.StatusBadRequest, "Invalid or expired refresh token")
 		return
 	}
 
-	//extract user id,role,email from claims
-	userID := uint(claims["id"].(float64))
-	role := claims["role"].(string)
-	email := claims["email"].(string)
-
 	//send success response
 	response.SendResponse(c, http.StatusOK, true, "User details retrieved successfully", gin.H{
-		"user_id": userID,
-		"role":    role,
-		"email":   email,
+		"user_id": claims.ID,
+		"role":    claims.Role,
+		"email":   claims.Email,
 	}, nil)
 }
@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"my-project/internal/helper"
+	"my-project/internal/logger"
+	"my-project/internal/model"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// dummyPasswordHash is compared against when the email is unknown, so a missing account
+// takes as long to reject as a wrong password
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password-for-timing"), bcrypt.DefaultCost)
+
+// maxLoginDelay caps the progressive delay between failed attempts
+const maxLoginDelay = time.Minute
+
+// loginPolicy holds the brute-force protection settings
+type loginPolicy struct {
+	window             time.Duration // Failures older than this are forgotten
+	lockout            time.Duration // How long an account stays locked
+	maxAccountFailures int64         // Failures that lock an account
+	maxIPFailures      int64         // Failures that block an IP
+	delayAfter         int64         // Failures before delays kick in
+}
+
+// loginPolicyFromEnv reads the brute-force protection settings
+func loginPolicyFromEnv() loginPolicy {
+	return loginPolicy{
+		window:             time.Second * time.Duration(helper.GetEnvInt64("LOGIN_FAILURE_WINDOW", 900)),
+		lockout:            time.Second * time.Duration(helper.GetEnvInt64("LOGIN_LOCKOUT_DURATION", 900)),
+		maxAccountFailures: helper.GetEnvInt64("LOGIN_MAX_FAILURES", 5),
+		maxIPFailures:      helper.GetEnvInt64("LOGIN_IP_MAX_FAILURES", 50),
+		delayAfter:         helper.GetEnvInt64("LOGIN_DELAY_AFTER_FAILURES", 2),
+	}
+}
+
+// failureStats counts recent failures matching a condition and returns the time of the latest one
+func failureStats(db *gorm.DB, since time.Time, column, value string) (int64, time.Time, error) {
+	var stats struct {
+		Count int64
+		Last  *time.Time
+	}
+	err := db.Model(&model.FailedLoginAttempt{}).
+		Select("COUNT(*) AS count, MAX(created_at) AS last").
+		Where(column+" = ? AND created_at > ?", value, since).
+		Scan(&stats).Error
+	if err != nil || stats.Last == nil {
+		return stats.Count, time.Time{}, err
+	}
+	return stats.Count, *stats.Last, nil
+}
+
+// loginRetryAfter reports how long a caller has to wait before the next sign-in attempt for
+// this email from this IP. Zero means the attempt may proceed.
+func loginRetryAfter(db *gorm.DB, policy loginPolicy, email, ip string) (time.Duration, error) {
+	since := time.Now().Add(-policy.window)
+
+	ipFailures, lastIPFailure, err := failureStats(db, since, "ip", ip)
+	if err != nil {
+		return 0, err
+	}
+	if ipFailures >= policy.maxIPFailures {
+		if wait := time.Until(lastIPFailure.Add(policy.lockout)); wait > 0 {
+			return wait, nil
+		}
+	}
+
+	accountFailures, lastAccountFailure, err := failureStats(db, since, "email", email)
+	if err != nil {
+		return 0, err
+	}
+
+	// Locked out
+	if accountFailures >= policy.maxAccountFailures {
+		return time.Until(lastAccountFailure.Add(policy.lockout)), nil
+	}
+
+	// Progressive delay: 1s, 2s, 4s ... between attempts once failures pile up
+	if accountFailures >= policy.delayAfter {
+		delay := time.Second << (accountFailures - policy.delayAfter)
+		if delay > maxLoginDelay {
+			delay = maxLoginDelay
+		}
+		return time.Until(lastAccountFailure.Add(delay)), nil
+	}
+
+	return 0, nil
+}
+
+// recordLoginFailure stores a failed attempt and reports whether it just locked the account
+func recordLoginFailure(db *gorm.DB, policy loginPolicy, email, ip string) (bool, error) {
+	// Forget attempts nobody looks at anymore
+	if err := db.Where("created_at < ?", time.Now().Add(-policy.window-policy.lockout)).Delete(&model.FailedLoginAttempt{}).Error; err != nil {
+		return false, err
+	}
+
+	if err := db.Create(&model.FailedLoginAttempt{Email: email, IP: ip}).Error; err != nil {
+		return false, err
+	}
+
+	failures, _, err := failureStats(db, time.Now().Add(-policy.window), "email", email)
+	if err != nil {
+		return false, err
+	}
+	return failures == policy.maxAccountFailures, nil
+}
+
+// clearLoginFailures resets the account throttle after a successful sign-in or unlock
+func clearLoginFailures(db *gorm.DB, email string) error {
+	return db.Where("email = ?", email).Delete(&model.FailedLoginAttempt{}).Error
+}
+
+// sendUnlockEmail emails a single-use link that lifts the lockout of the user's account
+func sendUnlockEmail(db *gorm.DB, user *model.User) error {
+	unlockToken := helper.GenerateRandomString(48)
+	expiresIn := helper.GetEnvInt64("ACCOUNT_UNLOCK_EXPIRES_IN", 3600)
+	unlockTokenRecord := &model.AccountUnlockToken{
+		TokenHash: helper.HashToken(unlockToken),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(time.Second * time.Duration(expiresIn)),
+	}
+	if err := db.Create(unlockTokenRecord).Error; err != nil {
+		return fmt.Errorf("failed to create unlock token: %w", err)
+	}
+
+	clientURL := os.Getenv("ADMIN_CLIENT_URL")
+	emailBody := fmt.Sprintf(`
+		<div>
+			<p>Hi, %s</p>
+			<p>Your account was temporarily locked after several failed sign in attempts.</p>
+			<p>If this was you, unlock your account right away by clicking the link below:</p>
+			<p>
+				<a href="%s/auth/unlock-account?token=%s">
+					Unlock Account
+				</a>
+			</p>
+			<p>If this wasn't you, someone may be trying to guess your password. Consider resetting it.</p>
+			<p>Thank you, <br> E-Commerce</p>
+		</div>`,
+		user.Name, clientURL, unlockToken)
+
+	return helper.SendEmail(user.Email, emailBody, "Your Account Was Locked")
+}
+
+// logAccountLocked records a lockout as a security event
+func logAccountLocked(email, ip, userAgent string) {
+	logger.ErrorLogger.Error("Security event: account locked after repeated failed sign ins",
+		zap.String("email", email),
+		zap.String("ip", ip),
+		zap.String("user_agent", userAgent),
+	)
+}
@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"my-project/internal/helper"
+	"my-project/internal/model"
+	"my-project/internal/response"
+	"my-project/internal/validation"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestMagicLink emails a single-use, short-lived sign-in link to the user
+func (h *AuthHandler) RequestMagicLink(c *gin.Context) {
+	req, err := helper.GetValidatedFromContext[validation.MagicLinkRequest](c)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Always answer the same way so the endpoint can't be used to discover accounts
+	successMessage := "If an account exists for this email, a sign in link has been sent"
+
+	var user model.User
+	if err := h.db.DB().Where("email = ?", req.Email).First(&user).Error; err != nil {
+		response.SendResponse[any](c, http.StatusOK, true, successMessage, nil, nil)
+		return
+	}
+
+	// Only the latest link works
+	if err := h.db.DB().Where("user_id = ? AND used_at IS NULL", user.ID).Delete(&model.MagicLinkToken{}).Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to create sign in link", err.Error())
+		return
+	}
+
+	// Generate magic link token, only its hash is stored
+	magicToken := helper.GenerateRandomString(48)
+	expiresIn := helper.GetEnvInt64("MAGIC_LINK_EXPIRES_IN", 600)
+	magicTokenRecord := &model.MagicLinkToken{
+		TokenHash: helper.HashToken(magicToken),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(time.Second * time.Duration(expiresIn)),
+	}
+	if err := h.db.DB().Create(magicTokenRecord).Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to create sign in link", err.Error())
+		return
+	}
+
+	// Send sign in email
+	clientURL := os.Getenv("ADMIN_CLIENT_URL")
+	emailBody := fmt.Sprintf(`
+		<div>
+			<p>Hi, %s</p>
+			<p>Click the link below to sign in to E-Commerce, no password needed:</p>
+			<p>
+				<a href="%s/auth/magic-link?token=%s">
+					Sign In
+				</a>
+			</p>
+			<p>This link will expire in %d minutes and can only be used once.</p>
+			<p>If you didn't request this link, you can ignore this email.</p>
+			<p>Thank you, <br> E-Commerce</p>
+		</div>`,
+		user.Name, clientURL, magicToken, expiresIn/60)
+
+	if err := helper.SendEmail(user.Email, emailBody, "Your Sign In Link"); err != nil {
+		log.Print("Failed to send magic link email", err.Error())
+	}
+
+	response.SendResponse[any](c, http.StatusOK, true, successMessage, nil, nil)
+}
+
+// VerifyMagicLink signs the user in with the token from a magic link email
+func (h *AuthHandler) VerifyMagicLink(c *gin.Context) {
+	req, err := helper.GetValidatedFromContext[validation.MagicLinkVerifyRequest](c)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Find an unused, unexpired magic link token
+	var magicTokenRecord model.MagicLinkToken
+	if err := h.db.DB().Preload("User").Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", helper.HashToken(req.Token), time.Now()).First(&magicTokenRecord).Error; err != nil {
+		response.ApiError(c, http.StatusBadRequest, "Invalid or expired sign in link")
+		return
+	}
+
+	// The owner was deleted, the preloaded user stays empty
+	if magicTokenRecord.User.ID == 0 {
+		response.ApiError(c, http.StatusBadRequest, "Invalid or expired sign in link")
+		return
+	}
+
+	tx := h.db.DB().Begin()
+
+	// Mark the token as used, the condition guards against concurrent use of the same token
+	result := tx.Model(&model.MagicLinkToken{}).Where("id = ? AND used_at IS NULL", magicTokenRecord.ID).Update("used_at", time.Now())
+	if result.Error != nil {
+		tx.Rollback()
+		response.ApiError(c, http.StatusInternalServerError, "Failed to sign in", result.Error.Error())
+		return
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		response.ApiError(c, http.StatusBadRequest, "Invalid or expired sign in link")
+		return
+	}
+
+	// Opening the emailed link proves the user owns the address
+	user := magicTokenRecord.User
+	if !user.IsVerified {
+		if err := claimUnverifiedAccount(tx, &user, "a sign in link"); err != nil {
+			tx.Rollback()
+			response.ApiError(c, http.StatusInternalServerError, "Failed to verify email", err.Error())
+			return
+		}
+	}
+
+	if err := clearLoginFailures(tx, user.Email); err != nil {
+		tx.Rollback()
+		response.ApiError(c, http.StatusInternalServerError, "Failed to reset sign in attempts", err.Error())
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to commit transaction", err.Error())
+		return
+	}
+
+	h.completeSignIn(c, &user, "Sign in successful")
+}
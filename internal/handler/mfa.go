@@ -0,0 +1,291 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"my-project/internal/audit"
+	"my-project/internal/database"
+	"my-project/internal/helper"
+	"my-project/internal/model"
+	"my-project/internal/response"
+	"my-project/internal/totp"
+	"my-project/internal/validation"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// recoveryCodeCount is the number of recovery codes a user gets
+const recoveryCodeCount = 10
+
+type MfaHandler struct {
+	db database.Service
+}
+
+func NewMfaHandler(db database.Service) *MfaHandler {
+	return &MfaHandler{db: db}
+}
+
+// EnrollTotp creates a new authenticator secret that still has to be confirmed with a code
+func (h *MfaHandler) EnrollTotp(c *gin.Context) {
+	userInfo, err := helper.GetUserInfoFromContext(c)
+	if err != nil {
+		response.ApiError(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	var factor model.TotpFactor
+	err = h.db.DB().Where("user_id = ?", userInfo.ID).First(&factor).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to fetch two-factor settings", err.Error())
+		return
+	}
+	if factor.EnabledAt != nil {
+		response.ApiError(c, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to generate secret", err.Error())
+		return
+	}
+
+	// Restarting the enrolment replaces the pending secret
+	factor.UserID = userInfo.ID
+	factor.Secret = secret
+	factor.LastUsedStep = 0
+	if err := h.db.DB().Save(&factor).Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to save two-factor settings", err.Error())
+		return
+	}
+
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = "E-Commerce"
+	}
+
+	response.SendResponse(c, http.StatusOK, true, "Scan the code with your authenticator app and confirm it", gin.H{
+		"secret":      secret,
+		"otpauth_uri": totp.URI(issuer, userInfo.Email, secret),
+	}, nil)
+}
+
+// ConfirmTotp enables two-factor authentication once the user proves the app generates valid codes
+func (h *MfaHandler) ConfirmTotp(c *gin.Context) {
+	userInfo, err := helper.GetUserInfoFromContext(c)
+	if err != nil {
+		response.ApiError(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	req, err := helper.GetValidatedFromContext[validation.TotpCodeRequest](c)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var factor model.TotpFactor
+	if err := h.db.DB().Where("user_id = ? AND enabled_at IS NULL", userInfo.ID).First(&factor).Error; err != nil {
+		response.ApiError(c, http.StatusNotFound, "No pending two-factor enrolment found")
+		return
+	}
+
+	step, ok := totp.Validate(factor.Secret, req.Code, time.Now())
+	if !ok {
+		response.ApiError(c, http.StatusBadRequest, "Invalid authentication code")
+		return
+	}
+
+	tx := h.db.DB().Begin()
+
+	now := time.Now()
+	if err := tx.Model(&factor).Updates(map[string]interface{}{"enabled_at": now, "last_used_step": step}).Error; err != nil {
+		tx.Rollback()
+		response.ApiError(c, http.StatusInternalServerError, "Failed to enable two-factor authentication", err.Error())
+		return
+	}
+
+	recoveryCodes, err := replaceRecoveryCodes(tx, userInfo.ID)
+	if err != nil {
+		tx.Rollback()
+		response.ApiError(c, http.StatusInternalServerError, "Failed to generate recovery codes", err.Error())
+		return
+	}
+	audit.Record(c, tx, audit.Event{Action: model.AuditMfaEnabled, Metadata: map[string]interface{}{"factor": "totp"}})
+
+	if err := tx.Commit().Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to commit transaction", err.Error())
+		return
+	}
+
+	response.SendResponse(c, http.StatusOK, true, "Two-factor authentication enabled, store your recovery codes safely", gin.H{
+		"recovery_codes": recoveryCodes,
+	}, nil)
+}
+
+// DisableTotp turns two-factor authentication off after checking a second factor
+func (h *MfaHandler) DisableTotp(c *gin.Context) {
+	userInfo, err := helper.GetUserInfoFromContext(c)
+	if err != nil {
+		response.ApiError(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	req, err := helper.GetValidatedFromContext[validation.MfaCodeRequest](c)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	valid, err := verifySecondFactor(h.db.DB(), userInfo.ID, req.Code, req.RecoveryCode)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to verify authentication code", err.Error())
+		return
+	}
+	if !valid {
+		response.ApiError(c, http.StatusUnauthorized, "Invalid authentication code")
+		return
+	}
+
+	tx := h.db.DB().Begin()
+	if err := tx.Where("user_id = ?", userInfo.ID).Delete(&model.TotpFactor{}).Error; err != nil {
+		tx.Rollback()
+		response.ApiError(c, http.StatusInternalServerError, "Failed to disable two-factor authentication", err.Error())
+		return
+	}
+	if err := tx.Where("user_id = ?", userInfo.ID).Delete(&model.RecoveryCode{}).Error; err != nil {
+		tx.Rollback()
+		response.ApiError(c, http.StatusInternalServerError, "Failed to disable two-factor authentication", err.Error())
+		return
+	}
+	audit.Record(c, tx, audit.Event{Action: model.AuditMfaDisabled, Metadata: map[string]interface{}{"factor": "totp"}})
+	if err := tx.Commit().Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to commit transaction", err.Error())
+		return
+	}
+
+	response.SendResponse(c, http.StatusOK, true, "Two-factor authentication disabled", gin.H{
+		"user_id": userInfo.ID,
+	}, nil)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of the user
+func (h *MfaHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	userInfo, err := helper.GetUserInfoFromContext(c)
+	if err != nil {
+		response.ApiError(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	req, err := helper.GetValidatedFromContext[validation.TotpCodeRequest](c)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	valid, err := verifySecondFactor(h.db.DB(), userInfo.ID, req.Code, "")
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to verify authentication code", err.Error())
+		return
+	}
+	if !valid {
+		response.ApiError(c, http.StatusUnauthorized, "Invalid authentication code")
+		return
+	}
+
+	recoveryCodes, err := replaceRecoveryCodes(h.db.DB(), userInfo.ID)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to generate recovery codes", err.Error())
+		return
+	}
+
+	response.SendResponse(c, http.StatusOK, true, "Recovery codes regenerated", gin.H{
+		"recovery_codes": recoveryCodes,
+	}, nil)
+}
+
+// hasMfaEnabled reports whether the user confirmed an authenticator app
+func hasMfaEnabled(db *gorm.DB, userID uint) (bool, error) {
+	var count int64
+	if err := db.Model(&model.TotpFactor{}).Where("user_id = ? AND enabled_at IS NOT NULL", userID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// verifySecondFactor checks an authenticator code or consumes a recovery code.
+// Every code is accepted only once: TOTP steps can't be replayed and recovery codes are marked used.
+func verifySecondFactor(db *gorm.DB, userID uint, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		var factor model.TotpFactor
+		if err := db.Where("user_id = ? AND enabled_at IS NOT NULL", userID).First(&factor).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return false, nil
+			}
+			return false, err
+		}
+
+		step, ok := totp.Validate(factor.Secret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+
+		result := db.Model(&model.TotpFactor{}).Where("id = ? AND last_used_step < ?", factor.ID, step).Update("last_used_step", step)
+		if result.Error != nil {
+			return false, result.Error
+		}
+		return result.RowsAffected == 1, nil
+	}
+
+	if recoveryCode != "" {
+		result := db.Model(&model.RecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, helper.HashToken(normalizeRecoveryCode(recoveryCode))).
+			Limit(1).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return false, result.Error
+		}
+		return result.RowsAffected == 1, nil
+	}
+
+	return false, nil
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and returns a fresh set, only their hashes are stored
+func replaceRecoveryCodes(db *gorm.DB, userID uint) ([]string, error) {
+	if err := db.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	records := make([]model.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 7)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw))[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+		records[i] = model.RecoveryCode{UserID: userID, CodeHash: helper.HashToken(code)}
+	}
+
+	if err := db.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode strips the formatting users may type along with a recovery code
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
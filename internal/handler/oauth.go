@@ -0,0 +1,476 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"my-project/internal/audit"
+	"my-project/internal/helper"
+	"my-project/internal/model"
+	"my-project/internal/oauth"
+	"my-project/internal/response"
+	"my-project/internal/validation"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+// Cookies holding the OAuth flow secrets between sign in and callback
+const (
+	oauthStateCookie    = "oauth_state"
+	oauthVerifierCookie = "oauth_verifier"
+	oauthNonceCookie    = "oauth_nonce"
+	oauthIntentCookie   = "oauth_intent"
+	oauthRedirectCookie = "oauth_redirect"
+)
+
+// oauthIntentLink starts the OAuth flow to link the provider to the signed-in account instead of signing in
+const oauthIntentLink = "link"
+
+// socialLinkCookie holds the token of a provider identity waiting to be linked
+const socialLinkCookie = "social_link"
+
+// oauthProvider resolves the :provider route parameter, answering 404 for unknown providers
+func (h *AuthHandler) oauthProvider(c *gin.Context) (oauth.Provider, bool) {
+	provider, ok := h.providers.Get(c.Param("provider"))
+	if !ok {
+		response.ApiError(c, http.StatusNotFound, "Unsupported OAuth provider", fmt.Sprintf("available providers: %v", h.providers.Names()))
+		return nil, false
+	}
+	return provider, true
+}
+
+// OAuthSignIn initiates the OAuth2 flow of the provider in the route
+func (h *AuthHandler) OAuthSignIn(c *gin.Context) {
+	provider, ok := h.oauthProvider(c)
+	if !ok {
+		return
+	}
+
+	// Browser flows name the frontend page to return to, only allowlisted pages are accepted
+	redirectURI := c.DefaultQuery("redirect_uri", os.Getenv("OAUTH_DEFAULT_REDIRECT_URI"))
+	if redirectURI != "" && !allowedRedirectURI(redirectURI) {
+		response.ApiError(c, http.StatusBadRequest, "redirect_uri is not allowed")
+		return
+	}
+
+	// Generate random state and a PKCE code verifier, only its S256 challenge leaves the server
+	state := helper.GenerateRandomString(32)
+	verifier := oauth2.GenerateVerifier()
+	opts := []oauth2.AuthCodeOption{oauth2.S256ChallengeOption(verifier)}
+
+	// Store state and verifier in cookies
+	c.SetCookie(oauthStateCookie, state, 600, "/", "", false, true)
+	c.SetCookie(oauthVerifierCookie, verifier, 600, "/", "", false, true)
+	if redirectURI != "" {
+		c.SetCookie(oauthRedirectCookie, redirectURI, 600, "/", "", false, true)
+	} else {
+		c.SetCookie(oauthRedirectCookie, "", -1, "/", "", false, true)
+	}
+
+	// ?intent=link links the provider to the signed-in account instead of signing in
+	if c.Query("intent") == oauthIntentLink {
+		c.SetCookie(oauthIntentCookie, oauthIntentLink, 600, "/", "", false, true)
+	} else {
+		c.SetCookie(oauthIntentCookie, "", -1, "/", "", false, true)
+	}
+
+	// OpenID Connect providers echo the nonce inside the signed ID token
+	if _, ok := provider.(oauth.OIDCProvider); ok {
+		nonce := helper.GenerateRandomString(32)
+		c.SetCookie(oauthNonceCookie, nonce, 600, "/", "", false, true)
+		opts = append(opts, oauth2.SetAuthURLParam("nonce", nonce))
+	}
+
+	// Redirect to the provider's consent page
+	url := provider.AuthCodeURL(state, opts...)
+	c.Redirect(http.StatusTemporaryRedirect, url)
+}
+
+// OAuthCallback handles the callback from the provider in the route
+func (h *AuthHandler) OAuthCallback(c *gin.Context) {
+	provider, ok := h.oauthProvider(c)
+	if !ok {
+		return
+	}
+
+	// Where to send the browser once done, errors included. Without it the callback answers with JSON.
+	redirectURI, _ := c.Cookie(oauthRedirectCookie)
+	if !allowedRedirectURI(redirectURI) {
+		redirectURI = ""
+	}
+
+	// The provider reports a cancelled or refused consent as ?error=
+	if providerError := c.Query("error"); providerError != "" {
+		clearOAuthCookies(c)
+		h.oauthError(c, redirectURI, http.StatusUnauthorized, fmt.Sprintf("%s sign in was cancelled", provider.DisplayName()), providerError)
+		return
+	}
+
+	// Get the flow secrets from cookies, they are single use
+	state, err := c.Cookie(oauthStateCookie)
+	if err != nil {
+		h.oauthError(c, redirectURI, http.StatusBadRequest, "State cookie not found")
+		return
+	}
+	verifier, err := c.Cookie(oauthVerifierCookie)
+	if err != nil {
+		h.oauthError(c, redirectURI, http.StatusBadRequest, "PKCE verifier cookie not found")
+		return
+	}
+	nonce, _ := c.Cookie(oauthNonceCookie)
+	intent, _ := c.Cookie(oauthIntentCookie)
+	clearOAuthCookies(c)
+
+	// Verify state
+	if state != c.Query("state") {
+		h.oauthError(c, redirectURI, http.StatusBadRequest, "Invalid state parameter")
+		return
+	}
+
+	// Exchange code for token, the provider checks the verifier against the challenge
+	oauthToken, err := provider.Exchange(c, c.Query("code"), oauth2.VerifierOption(verifier))
+	if err != nil {
+		h.oauthError(c, redirectURI, http.StatusInternalServerError, "Failed to exchange token", err.Error())
+		return
+	}
+
+	// Trust the signed ID token when the provider issues one, otherwise ask its user API
+	var userInfo *oauth.UserInfo
+	if oidcProvider, ok := provider.(oauth.OIDCProvider); ok {
+		userInfo, err = oidcProvider.VerifyIDToken(c, oauthToken, nonce)
+		if err != nil {
+			h.oauthError(c, redirectURI, http.StatusUnauthorized, fmt.Sprintf("Failed to verify %s ID token", provider.DisplayName()), err.Error())
+			return
+		}
+	} else {
+		userInfo, err = provider.UserInfo(c, oauthToken)
+		if err != nil {
+			h.oauthError(c, redirectURI, http.StatusInternalServerError, fmt.Sprintf("Failed to get user info from %s", provider.DisplayName()), err.Error())
+			return
+		}
+	}
+	if userInfo.Email == "" {
+		h.oauthError(c, redirectURI, http.StatusBadRequest, fmt.Sprintf("Your %s account has no email address", provider.DisplayName()))
+		return
+	}
+
+	providerName := model.Provider(provider.Name())
+
+	// A returning user is found by their provider account
+	var socialProfile model.SocialProfile
+	err = h.db.DB().Where("provider = ? AND provider_id = ?", providerName, userInfo.ProviderID).First(&socialProfile).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		h.oauthError(c, redirectURI, http.StatusInternalServerError, "Failed to fetch social profile", err.Error())
+		return
+	}
+	linked := err == nil
+
+	// Linking was requested explicitly by a signed-in user
+	if intent == oauthIntentLink {
+		if linked {
+			h.oauthError(c, redirectURI, http.StatusConflict, fmt.Sprintf("This %s account is already linked to an account", provider.DisplayName()))
+			return
+		}
+		h.startSocialLink(c, redirectURI, provider, userInfo)
+		return
+	}
+
+	// Start database transaction
+	tx := h.db.DB().Begin()
+
+	var user model.User
+	if linked {
+		if err := tx.First(&user, socialProfile.UserID).Error; err != nil {
+			tx.Rollback()
+			// Profiles of deleted accounts are kept until the account is purged
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				h.oauthError(c, redirectURI, http.StatusConflict, pendingDeletionMessage)
+				return
+			}
+			h.oauthError(c, redirectURI, http.StatusInternalServerError, "Failed to fetch user", err.Error())
+			return
+		}
+	} else {
+		err = tx.Where("email = ?", userInfo.Email).First(&user).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			tx.Rollback()
+			h.oauthError(c, redirectURI, http.StatusInternalServerError, "Failed to fetch user", err.Error())
+			return
+		}
+
+		// The email alone only proves ownership when the provider verified it.
+		// Otherwise the account owner has to sign in and confirm the link.
+		if user.ID != 0 && !userInfo.EmailVerified {
+			tx.Rollback()
+			h.startSocialLink(c, redirectURI, provider, userInfo)
+			return
+		}
+
+		// The provider just proved owning the email, so the owner takes over an account nobody verified
+		if user.ID != 0 && !user.IsVerified {
+			if err := claimUnverifiedAccount(tx, &user, provider.DisplayName()); err != nil {
+				tx.Rollback()
+				h.oauthError(c, redirectURI, http.StatusInternalServerError, "Failed to verify account", err.Error())
+				return
+			}
+		}
+	}
+
+	if user.ID == 0 {
+		// A deleted account keeps its email until it is purged
+		pendingDeletion, err := emailPendingDeletion(tx, userInfo.Email)
+		if err != nil {
+			tx.Rollback()
+			h.oauthError(c, redirectURI, http.StatusInternalServerError, "Failed to check email", err.Error())
+			return
+		}
+		if pendingDeletion {
+			tx.Rollback()
+			h.oauthError(c, redirectURI, http.StatusConflict, pendingDeletionMessage)
+			return
+		}
+
+		// Generate random password for new user
+		password := helper.GenerateRandomString(12)
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			tx.Rollback()
+			h.oauthError(c, redirectURI, http.StatusInternalServerError, "Failed to hash password", err.Error())
+			return
+		}
+
+		// Create new user if not exists, an unverified provider email still has to be verified by us
+		user = model.User{
+			Name:                 userInfo.Name,
+			Email:                userInfo.Email,
+			Password:             string(hashedPassword),
+			HasTemporaryPassword: true,
+			IsVerified:           userInfo.EmailVerified,
+			Role:                 "user",
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			tx.Rollback()
+			h.oauthError(c, redirectURI, http.StatusInternalServerError, "Failed to create user", err.Error())
+			return
+		}
+		audit.Record(c, tx, audit.Event{Action: model.AuditSignUp, ActorID: user.ID, Metadata: map[string]interface{}{"method": provider.Name()}})
+
+		// Send password via email
+		emailBody := fmt.Sprintf(`
+			<div>
+				<p>Hi, %s</p>
+				<p>Welcome to E-Commerce! Your account has been created with %s Sign-In.</p>
+				<p>Your temporary password is: <strong>%s</strong></p>
+				<p>Please change your password after signing in for security.</p>
+				<p>Thank you, <br> E-Commerce</p>
+			</div>`,
+			user.Name, provider.DisplayName(), password)
+
+		if err := helper.SendEmail(user.Email, emailBody, "Your E-Commerce Account Password"); err != nil {
+			log.Print("Failed to send password email", err.Error())
+		}
+	}
+
+	// Create or update social profile
+	if !linked {
+		// Create new social profile
+		socialProfile = model.SocialProfile{
+			UserID:     user.ID,
+			Provider:   providerName,
+			ProviderID: userInfo.ProviderID,
+			Name:       userInfo.Name,
+			PhotoURL:   userInfo.PictureURL,
+		}
+		if err := tx.Create(&socialProfile).Error; err != nil {
+			tx.Rollback()
+			h.oauthError(c, redirectURI, http.StatusConflict, fmt.Sprintf("A different %s account is already linked to this account", provider.DisplayName()), err.Error())
+			return
+		}
+		audit.Record(c, tx, audit.Event{Action: model.AuditSocialLinked, ActorID: user.ID, Metadata: map[string]interface{}{"provider": provider.Name()}})
+	} else {
+		// Update existing social profile
+		socialProfile.Name = userInfo.Name
+		socialProfile.PhotoURL = userInfo.PictureURL
+		if err := tx.Save(&socialProfile).Error; err != nil {
+			tx.Rollback()
+			h.oauthError(c, redirectURI, http.StatusInternalServerError, "Failed to update social profile", err.Error())
+			return
+		}
+	}
+
+	// Commit transaction
+	if err := tx.Commit().Error; err != nil {
+		h.oauthError(c, redirectURI, http.StatusInternalServerError, "Failed to commit transaction", err.Error())
+		return
+	}
+
+	// New accounts with an unverified provider email get the usual verification link
+	if !user.IsVerified {
+		if err := h.sendVerificationEmail(&user); err != nil {
+			log.Print("Failed to send verification email", err.Error())
+		}
+	}
+
+	// The account exists now, but like any other it can only be used once the email is verified
+	if !user.IsVerified {
+		h.oauthError(c, redirectURI, http.StatusForbidden, "Please verify your email before signing in.")
+		return
+	}
+
+	// Browser flows get a one-time code for the frontend instead of tokens in the URL
+	if redirectURI != "" {
+		h.redirectWithAuthorizationCode(c, redirectURI, &user)
+		return
+	}
+
+	h.completeSignIn(c, &user, fmt.Sprintf("%s sign in successful", provider.DisplayName()))
+}
+
+// startSocialLink parks the provider identity until a signed-in user confirms it at /user/social-profiles/link.
+// The token lives in an http-only cookie so only the browser that completed the OAuth flow can confirm it.
+func (h *AuthHandler) startSocialLink(c *gin.Context, redirectURI string, provider oauth.Provider, userInfo *oauth.UserInfo) {
+	linkToken := helper.GenerateRandomString(48)
+	expiresIn := helper.GetEnvInt64("SOCIAL_LINK_EXPIRES_IN", 600)
+	pendingLink := &model.PendingSocialLink{
+		TokenHash:  helper.HashToken(linkToken),
+		Provider:   model.Provider(provider.Name()),
+		ProviderID: userInfo.ProviderID,
+		Email:      userInfo.Email,
+		Name:       userInfo.Name,
+		PhotoURL:   userInfo.PictureURL,
+		ExpiresAt:  time.Now().Add(time.Second * time.Duration(expiresIn)),
+	}
+	if err := h.db.DB().Create(pendingLink).Error; err != nil {
+		h.oauthError(c, redirectURI, http.StatusInternalServerError, "Failed to start account linking", err.Error())
+		return
+	}
+
+	c.SetCookie(socialLinkCookie, linkToken, int(expiresIn), "/", "", false, true)
+
+	if redirectURI != "" {
+		redirectWithParams(c, redirectURI, map[string]string{
+			"link_required": "true",
+			"provider":      provider.Name(),
+		})
+		return
+	}
+
+	response.SendResponse(c, http.StatusAccepted, true, fmt.Sprintf("Sign in to your account and confirm linking your %s account", provider.DisplayName()), gin.H{
+		"link_required": true,
+		"provider":      provider.Name(),
+		"expires_at":    pendingLink.ExpiresAt,
+	}, nil)
+}
+
+// clearOAuthCookies removes the state, PKCE verifier, nonce and intent cookies
+func clearOAuthCookies(c *gin.Context) {
+	for _, name := range []string{oauthStateCookie, oauthVerifierCookie, oauthNonceCookie, oauthIntentCookie, oauthRedirectCookie} {
+		c.SetCookie(name, "", -1, "/", "", false, true)
+	}
+}
+
+// redirectWithAuthorizationCode sends the browser back to the frontend with a short-lived single-use code
+func (h *AuthHandler) redirectWithAuthorizationCode(c *gin.Context, redirectURI string, user *model.User) {
+	code := helper.GenerateRandomString(48)
+	authorizationCode := &model.AuthorizationCode{
+		CodeHash:  helper.HashToken(code),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(time.Second * time.Duration(helper.GetEnvInt64("OAUTH_CODE_EXPIRES_IN", 60))),
+	}
+	if err := h.db.DB().Create(authorizationCode).Error; err != nil {
+		h.oauthError(c, redirectURI, http.StatusInternalServerError, "Failed to create authorization code", err.Error())
+		return
+	}
+
+	redirectWithParams(c, redirectURI, map[string]string{"code": code})
+}
+
+// ExchangeCode swaps the authorization code from an OAuth redirect for the same response a sign-in gives
+func (h *AuthHandler) ExchangeCode(c *gin.Context) {
+	req, err := helper.GetValidatedFromContext[validation.ExchangeCodeRequest](c)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var authorizationCode model.AuthorizationCode
+	if err := h.db.DB().Preload("User").Where("code_hash = ? AND used_at IS NULL AND expires_at > ?", helper.HashToken(req.Code), time.Now()).First(&authorizationCode).Error; err != nil {
+		response.ApiError(c, http.StatusBadRequest, "Invalid or expired authorization code")
+		return
+	}
+
+	// Mark the code as used, the condition guards against concurrent use of the same code
+	result := h.db.DB().Model(&model.AuthorizationCode{}).Where("id = ? AND used_at IS NULL", authorizationCode.ID).Update("used_at", time.Now())
+	if result.Error != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to exchange authorization code", result.Error.Error())
+		return
+	}
+	if result.RowsAffected == 0 {
+		response.ApiError(c, http.StatusBadRequest, "Invalid or expired authorization code")
+		return
+	}
+
+	h.completeSignIn(c, &authorizationCode.User, "Sign in successful")
+}
+
+// oauthError reports a failed OAuth flow as JSON, or by redirecting to the frontend with error and error_description
+func (h *AuthHandler) oauthError(c *gin.Context, redirectURI string, status int, message string, details ...interface{}) {
+	if redirectURI == "" {
+		response.ApiError(c, status, message, details...)
+		return
+	}
+
+	errorCode := "server_error"
+	switch status {
+	case http.StatusBadRequest, http.StatusNotFound:
+		errorCode = "invalid_request"
+	case http.StatusUnauthorized, http.StatusForbidden:
+		errorCode = "access_denied"
+	case http.StatusConflict:
+		errorCode = "account_conflict"
+	}
+
+	redirectWithParams(c, redirectURI, map[string]string{
+		"error":             errorCode,
+		"error_description": message,
+	})
+}
+
+// redirectWithParams redirects to an allowlisted frontend URL after adding query parameters
+func redirectWithParams(c *gin.Context, redirectURI string, params map[string]string) {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Invalid redirect_uri", err.Error())
+		return
+	}
+
+	query := target.Query()
+	for key, value := range params {
+		query.Set(key, value)
+	}
+	target.RawQuery = query.Encode()
+
+	c.Redirect(http.StatusFound, target.String())
+}
+
+// allowedRedirectURI reports whether uri exactly matches an entry of OAUTH_REDIRECT_ALLOWLIST (comma separated)
+func allowedRedirectURI(uri string) bool {
+	if uri == "" {
+		return false
+	}
+	for _, allowed := range strings.Split(os.Getenv("OAUTH_REDIRECT_ALLOWLIST"), ",") {
+		if strings.TrimSpace(allowed) == uri {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,317 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"my-project/internal/database"
+	"my-project/internal/helper"
+	"my-project/internal/model"
+	"my-project/internal/response"
+	"my-project/internal/sms"
+	"my-project/internal/validation"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// phoneOtpDigits is the length of SMS codes
+	phoneOtpDigits = 6
+	// phoneOtpLimitWindow is how far back codes and wrong guesses count towards the daily limits
+	phoneOtpLimitWindow = 24 * time.Hour
+)
+
+var (
+	// errPhoneOtpCooldown is returned when a code was sent too recently
+	errPhoneOtpCooldown = errors.New("phone code sent too recently")
+	// errPhoneOtpDailyLimit is returned when the number got too many codes or wrong guesses in the last day
+	errPhoneOtpDailyLimit = errors.New("phone code daily limit reached")
+)
+
+type PhoneHandler struct {
+	db  database.Service
+	sms sms.Sender
+}
+
+func NewPhoneHandler(db database.Service, sender sms.Sender) *PhoneHandler {
+	return &PhoneHandler{db: db, sms: sender}
+}
+
+// SendPhoneVerification texts a code that confirms the user owns their phone number
+func (h *PhoneHandler) SendPhoneVerification(c *gin.Context) {
+	userInfo, err := helper.GetUserInfoFromContext(c)
+	if err != nil {
+		response.ApiError(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	var user model.User
+	if err := h.db.DB().First(&user, userInfo.ID).Error; err != nil {
+		response.ApiError(c, http.StatusNotFound, "User not found")
+		return
+	}
+	if user.PhoneNumber == "" {
+		response.ApiError(c, http.StatusBadRequest, "No phone number on this account")
+		return
+	}
+	if user.PhoneVerified {
+		response.ApiError(c, http.StatusConflict, "Phone number is already verified")
+		return
+	}
+
+	retryAfter, err := sendPhoneOtp(c, h.db.DB(), h.sms, &user, model.PhoneOtpVerify)
+	if errors.Is(err, errPhoneOtpCooldown) {
+		c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		response.ApiError(c, http.StatusTooManyRequests, "Please wait before requesting another code")
+		return
+	}
+	if errors.Is(err, errPhoneOtpDailyLimit) {
+		response.ApiError(c, http.StatusTooManyRequests, "Daily limit for verification codes reached, try again tomorrow")
+		return
+	}
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to send verification code", err.Error())
+		return
+	}
+
+	response.SendResponse[any](c, http.StatusOK, true, "Verification code sent", nil, nil)
+}
+
+// VerifyPhone marks the phone number as verified when the SMS code matches
+func (h *PhoneHandler) VerifyPhone(c *gin.Context) {
+	userInfo, err := helper.GetUserInfoFromContext(c)
+	if err != nil {
+		response.ApiError(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	req, err := helper.GetValidatedFromContext[validation.PhoneCodeRequest](c)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var user model.User
+	if err := h.db.DB().First(&user, userInfo.ID).Error; err != nil {
+		response.ApiError(c, http.StatusNotFound, "User not found")
+		return
+	}
+
+	ok, err := checkPhoneOtp(h.db.DB(), &user, model.PhoneOtpVerify, req.Code)
+	if errors.Is(err, errPhoneOtpDailyLimit) {
+		response.ApiError(c, http.StatusTooManyRequests, "Too many wrong codes for this phone number today, try again tomorrow")
+		return
+	}
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to check verification code", err.Error())
+		return
+	}
+	if !ok {
+		response.ApiError(c, http.StatusBadRequest, "Invalid or expired verification code")
+		return
+	}
+
+	// A number can only be verified on one account, since it is also a sign in identifier
+	var taken int64
+	if err := h.db.DB().Model(&model.User{}).Where("phone_number = ? AND phone_verified = ? AND id <> ?", user.PhoneNumber, true, user.ID).Count(&taken).Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to verify phone number", err.Error())
+		return
+	}
+	if taken > 0 {
+		response.ApiError(c, http.StatusConflict, "This phone number is already verified on another account")
+		return
+	}
+
+	if err := h.db.DB().Model(&model.User{}).Where("id = ?", user.ID).Update("phone_verified", true).Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to verify phone number", err.Error())
+		return
+	}
+
+	response.SendResponse(c, http.StatusOK, true, "Phone number verified successfully", gin.H{
+		"phone_number": user.PhoneNumber,
+	}, nil)
+}
+
+// RequestPhoneSignIn texts a sign-in code to a verified phone number
+func (h *AuthHandler) RequestPhoneSignIn(c *gin.Context) {
+	req, err := helper.GetValidatedFromContext[validation.PhoneSignInRequest](c)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Always answer the same way so the endpoint can't be used to discover accounts
+	successMessage := "If this phone number belongs to an account, a sign in code has been sent"
+
+	var user model.User
+	if err := h.db.DB().Where("phone_number = ? AND phone_verified = ?", req.PhoneNumber, true).First(&user).Error; err != nil {
+		response.SendResponse[any](c, http.StatusOK, true, successMessage, nil, nil)
+		return
+	}
+
+	// Cooldowns and daily limits are not reported either
+	if _, err := sendPhoneOtp(c, h.db.DB(), h.sms, &user, model.PhoneOtpSignIn); err != nil && !errors.Is(err, errPhoneOtpCooldown) && !errors.Is(err, errPhoneOtpDailyLimit) {
+		log.Print("Failed to send sign in code", err.Error())
+	}
+
+	response.SendResponse[any](c, http.StatusOK, true, successMessage, nil, nil)
+}
+
+// VerifyPhoneSignIn signs the user in with the code texted to their phone
+func (h *AuthHandler) VerifyPhoneSignIn(c *gin.Context) {
+	req, err := helper.GetValidatedFromContext[validation.PhoneSignInVerifyRequest](c)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	invalidMessage := "Invalid phone number or code"
+
+	var user model.User
+	if err := h.db.DB().Where("phone_number = ? AND phone_verified = ?", req.PhoneNumber, true).First(&user).Error; err != nil {
+		response.ApiError(c, http.StatusUnauthorized, invalidMessage)
+		return
+	}
+
+	// Code guesses count towards the same lockout as password guesses
+	if !h.allowSignInAttempt(c, user.Email) {
+		return
+	}
+
+	ok, err := checkPhoneOtp(h.db.DB(), &user, model.PhoneOtpSignIn, req.Code)
+	if errors.Is(err, errPhoneOtpDailyLimit) {
+		response.ApiError(c, http.StatusTooManyRequests, "Too many wrong codes for this phone number today, try again tomorrow")
+		return
+	}
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to check sign in code", err.Error())
+		return
+	}
+	if !ok {
+		h.recordSignInFailure(c, user.Email, &user)
+		response.ApiError(c, http.StatusUnauthorized, invalidMessage)
+		return
+	}
+
+	if err := clearLoginFailures(h.db.DB(), user.Email); err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to reset sign in attempts", err.Error())
+		return
+	}
+
+	h.completeSignIn(c, &user, "Sign in successful")
+}
+
+// sendPhoneOtp replaces any pending code of the purpose with a new one and texts it to the user.
+// Within the resend cooldown it returns errPhoneOtpCooldown and how long to wait, and once the number
+// got PHONE_OTP_DAILY_LIMIT codes or PHONE_OTP_DAILY_FAILURES wrong guesses in a day errPhoneOtpDailyLimit.
+func sendPhoneOtp(ctx context.Context, db *gorm.DB, sender sms.Sender, user *model.User, purpose model.PhoneOtpPurpose) (time.Duration, error) {
+	cooldown := time.Second * time.Duration(helper.GetEnvInt64("PHONE_OTP_RESEND_COOLDOWN", 60))
+	var lastOtp model.PhoneOtp
+	if err := db.Where("user_id = ? AND purpose = ?", user.ID, purpose).Order("created_at DESC").First(&lastOtp).Error; err == nil {
+		if retryAfter := time.Until(lastOtp.CreatedAt.Add(cooldown)); retryAfter > 0 {
+			return retryAfter, errPhoneOtpCooldown
+		}
+	}
+
+	// Every code costs an SMS and brings a fresh set of guesses, so a number only gets a few per day
+	codes, failures, err := phoneOtpUsage(db, user.PhoneNumber)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check sent codes: %w", err)
+	}
+	if codes >= helper.GetEnvInt64("PHONE_OTP_DAILY_LIMIT", 5) || failures >= helper.GetEnvInt64("PHONE_OTP_DAILY_FAILURES", 10) {
+		return 0, errPhoneOtpDailyLimit
+	}
+
+	// Codes older than the limit window are useless, drop them whenever a new one goes out
+	if err := db.Where("created_at < ?", time.Now().Add(-phoneOtpLimitWindow)).Delete(&model.PhoneOtp{}).Error; err != nil {
+		return 0, fmt.Errorf("failed to remove old codes: %w", err)
+	}
+
+	// Only the latest code works, earlier ones are expired but kept for the daily limits
+	if err := db.Model(&model.PhoneOtp{}).Where("user_id = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", user.ID, purpose, time.Now()).Update("expires_at", time.Now()).Error; err != nil {
+		return 0, fmt.Errorf("failed to replace previous codes: %w", err)
+	}
+
+	code := helper.GenerateNumericCode(phoneOtpDigits)
+	expiresIn := helper.GetEnvInt64("PHONE_OTP_EXPIRES_IN", 300)
+	otp := &model.PhoneOtp{
+		UserID:      user.ID,
+		PhoneNumber: user.PhoneNumber,
+		Purpose:     purpose,
+		CodeHash:    helper.HashToken(code),
+		ExpiresAt:   time.Now().Add(time.Second * time.Duration(expiresIn)),
+	}
+	if err := db.Create(otp).Error; err != nil {
+		return 0, fmt.Errorf("failed to create code: %w", err)
+	}
+
+	message := fmt.Sprintf("Your E-Commerce code is %s. It expires in %d minutes. Never share it with anyone.", code, expiresIn/60)
+	if err := sender.Send(ctx, user.PhoneNumber, message); err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
+// checkPhoneOtp reports whether code matches the user's pending code of the purpose and consumes it.
+// Wrong guesses count towards PHONE_OTP_MAX_ATTEMPTS, after which the code stops working, and towards
+// PHONE_OTP_DAILY_FAILURES of the number, after which it returns errPhoneOtpDailyLimit for any code.
+func checkPhoneOtp(db *gorm.DB, user *model.User, purpose model.PhoneOtpPurpose, code string) (bool, error) {
+	maxAttempts := helper.GetEnvInt64("PHONE_OTP_MAX_ATTEMPTS", 5)
+
+	_, failures, err := phoneOtpUsage(db, user.PhoneNumber)
+	if err != nil {
+		return false, err
+	}
+	if failures >= helper.GetEnvInt64("PHONE_OTP_DAILY_FAILURES", 10) {
+		return false, errPhoneOtpDailyLimit
+	}
+
+	var otp model.PhoneOtp
+	err = db.Where("user_id = ? AND purpose = ? AND used_at IS NULL AND expires_at > ? AND attempts < ?", user.ID, purpose, time.Now(), maxAttempts).
+		Order("created_at DESC").First(&otp).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// The code was sent to a number the user no longer has
+	if otp.PhoneNumber != user.PhoneNumber {
+		return false, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(otp.CodeHash), []byte(helper.HashToken(code))) != 1 {
+		if err := db.Model(&model.PhoneOtp{}).Where("id = ?", otp.ID).Update("attempts", gorm.Expr("attempts + 1")).Error; err != nil {
+			return false, err
+		}
+		return false, nil
+	}
+
+	// Mark the code as used, the condition guards against concurrent use of the same code
+	result := db.Model(&model.PhoneOtp{}).Where("id = ? AND used_at IS NULL", otp.ID).Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// phoneOtpUsage counts the codes texted to the number and the wrong guesses made against them within phoneOtpLimitWindow
+func phoneOtpUsage(db *gorm.DB, phoneNumber string) (int64, int64, error) {
+	var usage struct {
+		Codes    int64
+		Failures int64
+	}
+	err := db.Model(&model.PhoneOtp{}).
+		Select("COUNT(*) AS codes, COALESCE(SUM(attempts), 0) AS failures").
+		Where("phone_number = ? AND created_at > ?", phoneNumber, time.Now().Add(-phoneOtpLimitWindow)).
+		Scan(&usage).Error
+	return usage.Codes, usage.Failures, err
+}
@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"my-project/internal/audit"
+	"my-project/internal/database"
+	"my-project/internal/helper"
+	"my-project/internal/model"
+	"my-project/internal/rbac"
+	"my-project/internal/response"
+	"my-project/internal/validation"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type RoleHandler struct {
+	db          database.Service
+	permissions *rbac.Service
+}
+
+func NewRoleHandler(db database.Service, permissions *rbac.Service) *RoleHandler {
+	return &RoleHandler{db: db, permissions: permissions}
+}
+
+// GetRoles lists all roles with their permissions
+func (h *RoleHandler) GetRoles(c *gin.Context) {
+	var roles []model.Role
+	if err := h.db.DB().Preload("Permissions").Order("name").Find(&roles).Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to fetch roles", err.Error())
+		return
+	}
+
+	response.SendResponse(c, http.StatusOK, true, "Roles fetched successfully", roles, nil)
+}
+
+// GetPermissions lists every permission that can be granted
+func (h *RoleHandler) GetPermissions(c *gin.Context) {
+	var permissions []model.Permission
+	if err := h.db.DB().Order("name").Find(&permissions).Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to fetch permissions", err.Error())
+		return
+	}
+
+	response.SendResponse(c, http.StatusOK, true, "Permissions fetched successfully", permissions, nil)
+}
+
+// CreateRole creates a role with the given permissions
+func (h *RoleHandler) CreateRole(c *gin.Context) {
+	req, err := helper.GetValidatedFromContext[validation.CreateRoleRequest](c)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	permissions, ok := h.findPermissions(c, req.Permissions)
+	if !ok {
+		return
+	}
+
+	var existing int64
+	if err := h.db.DB().Model(&model.Role{}).Where("name = ?", req.Name).Count(&existing).Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to create role", err.Error())
+		return
+	}
+	if existing > 0 {
+		response.ApiError(c, http.StatusConflict, "Role already exists")
+		return
+	}
+
+	role := model.Role{Name: req.Name, Description: req.Description, Permissions: permissions}
+	if err := h.db.DB().Create(&role).Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to create role", err.Error())
+		return
+	}
+	audit.Record(c, h.db.DB(), audit.Event{Action: model.AuditRoleCreated, Metadata: map[string]interface{}{"role": role.Name, "permissions": req.Permissions}})
+
+	response.SendResponse(c, http.StatusCreated, true, "Role created successfully", role, nil)
+}
+
+// SetRolePermissions replaces the permissions of a role
+func (h *RoleHandler) SetRolePermissions(c *gin.Context) {
+	req, err := helper.GetValidatedFromContext[validation.RolePermissionsRequest](c)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var role model.Role
+	if err := h.db.DB().Where("name = ?", c.Param("name")).First(&role).Error; err != nil {
+		response.ApiError(c, http.StatusNotFound, "Role not found")
+		return
+	}
+
+	permissions, ok := h.findPermissions(c, req.Permissions)
+	if !ok {
+		return
+	}
+
+	// Admins could otherwise lock everybody out of role management
+	if role.Name == string(model.RoleAdmin) && !containsPermission(permissions, model.PermissionRolesManage) {
+		response.ApiError(c, http.StatusConflict, "The admin role must keep the roles:manage permission")
+		return
+	}
+
+	if err := h.db.DB().Model(&role).Association("Permissions").Replace(permissions); err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to update role permissions", err.Error())
+		return
+	}
+	h.permissions.Invalidate()
+	audit.Record(c, h.db.DB(), audit.Event{Action: model.AuditRolePermissionsSet, Metadata: map[string]interface{}{"role": role.Name, "permissions": req.Permissions}})
+
+	role.Permissions = permissions
+	response.SendResponse(c, http.StatusOK, true, "Role permissions updated successfully", role, nil)
+}
+
+// AssignRole changes the role of a user, it applies to the user's next request
+func (h *RoleHandler) AssignRole(c *gin.Context) {
+	userInfo, err := helper.GetUserInfoFromContext(c)
+	if err != nil {
+		response.ApiError(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	req, err := helper.GetValidatedFromContext[validation.AssignRoleRequest](c)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var user model.User
+	if err := h.db.DB().First(&user, c.Param("id")).Error; err != nil {
+		response.ApiError(c, http.StatusNotFound, "User not found")
+		return
+	}
+	if user.ID == userInfo.ID {
+		response.ApiError(c, http.StatusConflict, "You can't change your own role")
+		return
+	}
+
+	var role model.Role
+	if err := h.db.DB().Where("name = ?", req.Role).First(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.ApiError(c, http.StatusBadRequest, "Role not found")
+			return
+		}
+		response.ApiError(c, http.StatusInternalServerError, "Failed to fetch role", err.Error())
+		return
+	}
+
+	if err := h.db.DB().Model(&user).Update("role", role.Name).Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to assign role", err.Error())
+		return
+	}
+	audit.Record(c, h.db.DB(), audit.Event{
+		Action:   model.AuditRoleAssigned,
+		TargetID: user.ID,
+		Metadata: map[string]interface{}{"from": user.Role, "to": role.Name},
+	})
+
+	response.SendResponse(c, http.StatusOK, true, "Role assigned successfully", gin.H{
+		"user_id": user.ID,
+		"role":    role.Name,
+	}, nil)
+}
+
+// findPermissions loads the named permissions and answers 400 when one doesn't exist
+func (h *RoleHandler) findPermissions(c *gin.Context, names []string) ([]model.Permission, bool) {
+	permissions := []model.Permission{}
+	if len(names) == 0 {
+		return permissions, true
+	}
+
+	if err := h.db.DB().Where("name IN ?", names).Find(&permissions).Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to fetch permissions", err.Error())
+		return nil, false
+	}
+	for _, name := range names {
+		if !containsPermission(permissions, name) {
+			response.ApiError(c, http.StatusBadRequest, "Unknown permission", name)
+			return nil, false
+		}
+	}
+	return permissions, true
+}
+
+// containsPermission reports whether the permission is in the list
+func containsPermission(permissions []model.Permission, name string) bool {
+	for _, permission := range permissions {
+		if permission.Name == name {
+			return true
+		}
+	}
+	return false
+}
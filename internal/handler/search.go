@@ -5,6 +5,7 @@ import (
 	"my-project/internal/database"
 	"my-project/internal/helper"
 	"my-project/internal/model"
+	"my-project/internal/rbac"
 	"my-project/internal/response"
 	"my-project/internal/types"
 	"my-project/internal/validation"
@@ -14,11 +15,12 @@ import (
 )
 
 type SearchHandler struct {
-	db database.Service
+	db          database.Service
+	permissions *rbac.Service
 }
 
-func NewSearchHandler(db database.Service) *SearchHandler {
-	return &SearchHandler{db: db}
+func NewSearchHandler(db database.Service, permissions *rbac.Service) *SearchHandler {
+	return &SearchHandler{db: db, permissions: permissions}
 }
 
 func (h *SearchHandler) CreateResponse(c *gin.Context) {
@@ -251,10 +253,17 @@ func (h *SearchHandler) GetSearchByID(c *gin.Context) {
 		return
 	}
 
-	// Validate user ownership
+	// Validate user ownership, unless the role may read every search
 	if search.UserID != userInfo.ID {
-		response.ApiError(c, http.StatusForbidden, "You are not authorized to access this search")
-		return
+		readAny, err := h.permissions.HasPermission(userInfo.Role, model.PermissionSearchReadAny)
+		if err != nil {
+			response.ApiError(c, http.StatusInternalServerError, "Failed to check permissions", err.Error())
+			return
+		}
+		if !readAny {
+			response.ApiError(c, http.StatusForbidden, "You are not authorized to access this search")
+			return
+		}
 	}
 
 	response.SendResponse(c, http.StatusOK, true, "Search fetched successfully", search, nil)
@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"my-project/internal/audit"
+	"my-project/internal/database"
+	"my-project/internal/helper"
+	"my-project/internal/model"
+	"my-project/internal/response"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type SocialProfileHandler struct {
+	db database.Service
+}
+
+func NewSocialProfileHandler(db database.Service) *SocialProfileHandler {
+	return &SocialProfileHandler{db: db}
+}
+
+// GetSocialProfiles lists the provider accounts linked to the authenticated user
+func (h *SocialProfileHandler) GetSocialProfiles(c *gin.Context) {
+	userInfo, err := helper.GetUserInfoFromContext(c)
+	if err != nil {
+		response.ApiError(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	var socialProfiles []model.SocialProfile
+	if err := h.db.DB().Where("user_id = ?", userInfo.ID).Order("created_at ASC").Find(&socialProfiles).Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to fetch social profiles", err.Error())
+		return
+	}
+
+	response.SendResponse(c, http.StatusOK, true, "Social profiles fetched successfully", socialProfiles, nil)
+}
+
+// LinkSocialProfile confirms the pending provider identity from the link cookie and links it to the authenticated user
+func (h *SocialProfileHandler) LinkSocialProfile(c *gin.Context) {
+	userInfo, err := helper.GetUserInfoFromContext(c)
+	if err != nil {
+		response.ApiError(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	linkToken, err := c.Cookie(socialLinkCookie)
+	if err != nil || linkToken == "" {
+		response.ApiError(c, http.StatusBadRequest, "No account waiting to be linked, please sign in with the provider again")
+		return
+	}
+	c.SetCookie(socialLinkCookie, "", -1, "/", "", false, true)
+
+	var pendingLink model.PendingSocialLink
+	if err := h.db.DB().Where("token_hash = ? AND expires_at > ?", helper.HashToken(linkToken), time.Now()).First(&pendingLink).Error; err != nil {
+		response.ApiError(c, http.StatusBadRequest, "Account link expired, please sign in with the provider again")
+		return
+	}
+
+	tx := h.db.DB().Begin()
+
+	// Deleting the pending link first makes it single use
+	result := tx.Delete(&model.PendingSocialLink{}, pendingLink.ID)
+	if result.Error != nil {
+		tx.Rollback()
+		response.ApiError(c, http.StatusInternalServerError, "Failed to link account", result.Error.Error())
+		return
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		response.ApiError(c, http.StatusBadRequest, "Account link expired, please sign in with the provider again")
+		return
+	}
+
+	// The provider identity may have been linked to some account in the meantime
+	var existing model.SocialProfile
+	err = tx.Where("(provider = ? AND provider_id = ?) OR (provider = ? AND user_id = ?)", pendingLink.Provider, pendingLink.ProviderID, pendingLink.Provider, userInfo.ID).First(&existing).Error
+	if err == nil {
+		tx.Rollback()
+		response.ApiError(c, http.StatusConflict, "This provider is already linked, unlink it first")
+		return
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		tx.Rollback()
+		response.ApiError(c, http.StatusInternalServerError, "Failed to link account", err.Error())
+		return
+	}
+
+	socialProfile := model.SocialProfile{
+		UserID:     userInfo.ID,
+		Provider:   pendingLink.Provider,
+		ProviderID: pendingLink.ProviderID,
+		Name:       pendingLink.Name,
+		PhotoURL:   pendingLink.PhotoURL,
+	}
+	if err := tx.Create(&socialProfile).Error; err != nil {
+		tx.Rollback()
+		response.ApiError(c, http.StatusInternalServerError, "Failed to link account", err.Error())
+		return
+	}
+	audit.Record(c, tx, audit.Event{Action: model.AuditSocialLinked, Metadata: map[string]interface{}{"provider": socialProfile.Provider}})
+
+	if err := tx.Commit().Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to commit transaction", err.Error())
+		return
+	}
+
+	response.SendResponse(c, http.StatusCreated, true, "Account linked successfully", socialProfile, nil)
+}
+
+// UnlinkSocialProfile removes a provider from the authenticated user unless it is their last way to sign in
+func (h *SocialProfileHandler) UnlinkSocialProfile(c *gin.Context) {
+	userInfo, err := helper.GetUserInfoFromContext(c)
+	if err != nil {
+		response.ApiError(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	var socialProfile model.SocialProfile
+	if err := h.db.DB().Where("user_id = ? AND provider = ?", userInfo.ID, c.Param("provider")).First(&socialProfile).Error; err != nil {
+		response.ApiError(c, http.StatusNotFound, "Social profile not found")
+		return
+	}
+
+	loginMethods, err := countLoginMethods(h.db.DB(), userInfo.ID)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to check sign in methods", err.Error())
+		return
+	}
+	if loginMethods <= 1 {
+		response.ApiError(c, http.StatusConflict, "This is your last way to sign in, set a password or add a passkey first")
+		return
+	}
+
+	// Hard delete so the provider can be linked again later
+	if err := h.db.DB().Unscoped().Delete(&socialProfile).Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to unlink account", err.Error())
+		return
+	}
+	audit.Record(c, h.db.DB(), audit.Event{Action: model.AuditSocialUnlinked, Metadata: map[string]interface{}{"provider": socialProfile.Provider}})
+
+	response.SendResponse(c, http.StatusOK, true, "Account unlinked successfully", gin.H{
+		"provider": socialProfile.Provider,
+	}, nil)
+}
+
+// countLoginMethods counts the ways a user can sign in: a password they chose, linked providers and passkeys
+func countLoginMethods(db *gorm.DB, userID uint) (int64, error) {
+	var user model.User
+	if err := db.Select("id", "has_temporary_password").First(&user, userID).Error; err != nil {
+		return 0, err
+	}
+
+	var socialProfiles, passkeys int64
+	if err := db.Model(&model.SocialProfile{}).Where("user_id = ?", userID).Count(&socialProfiles).Error; err != nil {
+		return 0, err
+	}
+	if err := db.Model(&model.WebauthnCredential{}).Where("user_id = ?", userID).Count(&passkeys).Error; err != nil {
+		return 0, err
+	}
+
+	total := socialProfiles + passkeys
+	if !user.HasTemporaryPassword {
+		total++
+	}
+	return total, nil
+}
@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"my-project/internal/database"
+	"my-project/internal/helper"
+	"my-project/internal/logger"
+	"my-project/internal/model"
+	"my-project/internal/token"
+	"my-project/internal/validation"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Token type hints of RFC 7662 and RFC 7009
+const (
+	accessTokenHint  = "access_token"
+	refreshTokenHint = "refresh_token"
+)
+
+// TokenHandler serves the OAuth2 introspection and revocation endpoints for other services.
+// They answer in the RFC formats rather than the usual response envelope.
+type TokenHandler struct {
+	db      database.Service
+	tokens  token.Service
+	clients map[string]string // Client ID to secret
+}
+
+func NewTokenHandler(db database.Service, tokens token.Service) *TokenHandler {
+	return &TokenHandler{db: db, tokens: tokens, clients: tokenClientsFromEnv()}
+}
+
+// tokenClientsFromEnv reads TOKEN_CLIENTS, comma separated `client_id:client_secret` pairs
+func tokenClientsFromEnv() map[string]string {
+	clients := map[string]string{}
+	for _, pair := range strings.Split(os.Getenv("TOKEN_CLIENTS"), ",") {
+		id, secret, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if ok && id != "" && secret != "" {
+			clients[id] = secret
+		}
+	}
+	return clients
+}
+
+// Introspect reports whether a token is active and what it carries (RFC 7662)
+func (h *TokenHandler) Introspect(c *gin.Context) {
+	var req validation.TokenRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": err.Error()})
+		return
+	}
+
+	for _, kind := range tokenKinds(req.TokenTypeHint) {
+		claims, err := h.tokens.Verify(kind, req.Token)
+		if err != nil {
+			continue
+		}
+
+		active, err := h.tokenActive(kind, req.Token, claims)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		if !active {
+			break
+		}
+
+		tokenType := accessTokenHint
+		if kind == token.Refresh {
+			tokenType = refreshTokenHint
+		}
+		introspection := gin.H{
+			"active":     true,
+			"token_type": tokenType,
+			"sub":        claims.Subject,
+			"username":   claims.Email,
+			"role":       claims.Role,
+			"iss":        claims.Issuer,
+			"aud":        claims.Audience,
+			"exp":        claims.ExpiresAt.Unix(),
+			"iat":        claims.IssuedAt.Unix(),
+			"nbf":        claims.NotBefore.Unix(),
+			"jti":        claims.RegisteredClaims.ID,
+		}
+		// Impersonation tokens name the admin acting as the user (RFC 8693)
+		if claims.Act != nil {
+			introspection["act"] = claims.Act
+		}
+		c.JSON(http.StatusOK, introspection)
+		return
+	}
+
+	// Nothing else is revealed about inactive or unknown tokens
+	c.JSON(http.StatusOK, gin.H{"active": false})
+}
+
+// Revoke invalidates an access or refresh token (RFC 7009). Unknown or invalid tokens still get 200.
+func (h *TokenHandler) Revoke(c *gin.Context) {
+	var req validation.TokenRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": err.Error()})
+		return
+	}
+
+	for _, kind := range tokenKinds(req.TokenTypeHint) {
+		claims, err := h.tokens.Verify(kind, req.Token)
+		if err != nil {
+			continue
+		}
+
+		if kind == token.Access {
+			err = h.denyAccessToken(claims)
+		} else {
+			err = h.revokeRefreshToken(req.Token, claims)
+		}
+		if err != nil {
+			logger.ErrorLogger.Error("Failed to revoke token", zap.Error(err), zap.String("kind", string(kind)))
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "server_error"})
+			return
+		}
+		break
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// tokenActive checks the server-side state of a token with a valid signature. Tokens of deleted,
+// disabled or banned users and tokens from before a forced sign out are refused like AuthMiddleware does.
+func (h *TokenHandler) tokenActive(kind token.Kind, tokenString string, claims *token.Claims) (bool, error) {
+	var user model.User
+	if err := h.db.DB().Select("status", "tokens_revoked_at").First(&user, claims.ID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if !user.IsActive() || (claims.IssuedAt != nil && user.TokenRevoked(claims.IssuedAt.Time)) {
+		return false, nil
+	}
+
+	if kind == token.Access {
+		var denied int64
+		if err := h.db.DB().Model(&model.RevokedToken{}).Where("jti = ?", claims.RegisteredClaims.ID).Count(&denied).Error; err != nil {
+			return false, err
+		}
+		return denied == 0, nil
+	}
+
+	// A refresh token is active while its row exists and wasn't rotated
+	var active int64
+	err := h.db.DB().Model(&model.RefreshToken{}).
+		Where("token_hash = ? AND user_id = ? AND used_at IS NULL AND expires_at > ?", helper.HashToken(tokenString), claims.ID, time.Now()).
+		Count(&active).Error
+	return active > 0, err
+}
+
+// denyAccessToken adds the token to the denylist until it expires
+func (h *TokenHandler) denyAccessToken(claims *token.Claims) error {
+	// Entries of expired tokens are useless, drop them whenever a new one comes in
+	if err := h.db.DB().Where("expires_at < ?", time.Now()).Delete(&model.RevokedToken{}).Error; err != nil {
+		return err
+	}
+
+	return h.db.DB().Clauses(clause.OnConflict{DoNothing: true}).Create(&model.RevokedToken{
+		JTI:       claims.RegisteredClaims.ID,
+		UserID:    claims.ID,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}).Error
+}
+
+// revokeRefreshToken ends the whole session the refresh token belongs to
+func (h *TokenHandler) revokeRefreshToken(tokenString string, claims *token.Claims) error {
+	var refreshTokenRecord model.RefreshToken
+	if err := h.db.DB().Where("token_hash = ? AND user_id = ?", helper.HashToken(tokenString), claims.ID).First(&refreshTokenRecord).Error; err != nil {
+		return nil // Already gone
+	}
+	return h.db.DB().Where("family_id = ? AND user_id = ?", refreshTokenRecord.FamilyID, refreshTokenRecord.UserID).Delete(&model.RefreshToken{}).Error
+}
+
+// RequireClient checks the client credentials sent with HTTP Basic auth or as
+// client_id/client_secret form fields, and answers 401 invalid_client otherwise
+func (h *TokenHandler) RequireClient(c *gin.Context) {
+	clientID, clientSecret, ok := c.Request.BasicAuth()
+	if !ok {
+		clientID, clientSecret = c.PostForm("client_id"), c.PostForm("client_secret")
+	}
+
+	secret, known := h.clients[clientID]
+	if !known || clientSecret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(clientSecret)) != 1 {
+		c.Header("WWW-Authenticate", `Basic realm="token"`)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_client"})
+		return
+	}
+	c.Next()
+}
+
+// tokenKinds orders the kinds to try, the hint only decides which one goes first
+func tokenKinds(hint string) []token.Kind {
+	if hint == refreshTokenHint {
+		return []token.Kind{token.Refresh, token.Access}
+	}
+	return []token.Kind{token.Access, token.Refresh}
+}
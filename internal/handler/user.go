@@ -2,7 +2,7 @@ package handler
 
 import (
 	"errors"
-	"fmt"
+	"my-project/internal/audit"
 	"my-project/internal/database"
 	"my-project/internal/helper"
 	"my-project/internal/model"
@@ -10,9 +10,10 @@ import (
 	"my-project/internal/validation"
 	"net/http"
 	"path/filepath"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
@@ -30,21 +31,13 @@ func (h *UserHandler) HelloUser(c *gin.Context) {
 
 // GetProfile handles fetching the authenticated user's profile
 func (h *UserHandler) GetProfile(c *gin.Context) {
-	// Get user claims from context (set by auth middleware)
-	userData, exists := c.Get("user")
-	if !exists {
-		response.ApiError(c, http.StatusUnauthorized, "User not authenticated")
+	// Get user info from context (set by auth middleware)
+	userInfo, err := helper.GetUserInfoFromContext(c)
+	if err != nil {
+		response.ApiError(c, http.StatusUnauthorized, err.Error())
 		return
 	}
-
-	claims, ok := userData.(jwt.MapClaims)
-	if !ok {
-		response.ApiError(c, http.StatusInternalServerError, "Invalid user data format")
-		return
-	}
-
-	// Extract user ID from claims
-	userID := uint(claims["id"].(float64))
+	userID := userInfo.ID
 
 	// Fetch user with related data
 	var user model.User
@@ -60,26 +53,12 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
 // UpdateProfile handles updating the authenticated user's profile
 func (h *UserHandler) UpdateProfile(c *gin.Context) {
 	//get userinfo from context (set by auth middleware)
-	userInterface, exist := c.Get("user")
-	if !exist {
-		response.ApiError(c, http.StatusUnauthorized, "User not authenticated")
-		return
-	}
-	// Type assertion to jwt.MapClaims
-	userInfo, ok := userInterface.(jwt.MapClaims)
-	if !ok {
-		response.ApiError(c, http.StatusInternalServerError, "Invalid user data format")
-		return
-	}
-
-	// Safely extract user ID
-	idFloat, ok := userInfo["id"].(float64)
-	if !ok {
-		response.ApiError(c, http.StatusInternalServerError, "User ID not found or invalid")
+	userInfo, err := helper.GetUserInfoFromContext(c)
+	if err != nil {
+		response.ApiError(c, http.StatusUnauthorized, err.Error())
 		return
 	}
-
-	userID := uint(idFloat) // Convert float64 to uint
+	userID := userInfo.ID
 
 	//get request body from context (set by validation middleware)
 	validatedRequest, exist := c.Get("validated")
@@ -113,13 +92,16 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
 		}
 		return
 	}
-	fmt.Printf("Request body:\n%+v\n", req)
+
+	// Names of the changed fields, for the audit log
+	var changed []string
 
 	// Update User model fields
 	userUpdated := false
 	if req.Name != "" && user.Name != req.Name {
 		user.Name = req.Name
 		userUpdated = true
+		changed = append(changed, "name")
 	}
 
 	if userUpdated {
@@ -140,14 +122,17 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
 	if req.Address != "" && user.UserDetail.Address != req.Address {
 		user.UserDetail.Address = req.Address
 		userDetailUpdated = true
+		changed = append(changed, "address")
 	}
 	if req.City != "" && user.UserDetail.City != req.City {
 		user.UserDetail.City = req.City
 		userDetailUpdated = true
+		changed = append(changed, "city")
 	}
 	if req.Road != "" && user.UserDetail.Road != req.Road {
 		user.UserDetail.Road = req.Road
 		userDetailUpdated = true
+		changed = append(changed, "road")
 	}
 
 	// Handle Image Upload
@@ -173,7 +158,6 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
 			user.UserDetail.Image.DiskType = model.DiskType(uploadedFile.DiskType)
 			user.UserDetail.Image.OriginalName = uploadedFile.OriginalName
 			user.UserDetail.Image.ModifiedName = uploadedFile.ModifiedName
-			fmt.Println("Image record updated:", user.UserDetail.Image)
 			if err := tx.Save(user.UserDetail.Image).Error; err != nil {
 				tx.Rollback()
 				response.ApiError(c, http.StatusInternalServerError, "Failed to update image record: "+err.Error())
@@ -194,9 +178,9 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
 				return
 			}
 			user.UserDetail.Image = &newImage
-			fmt.Println("Image record created:", user.UserDetail.Image)
 		}
 		userDetailUpdated = true
+		changed = append(changed, "image")
 	}
 
 	//* Save UserDetail if it's new (ID=0) or if fields were updated (including image)
@@ -208,6 +192,10 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
 		}
 	}
 
+	if len(changed) > 0 {
+		audit.Record(c, tx, audit.Event{Action: model.AuditProfileUpdated, Metadata: map[string]interface{}{"fields": changed}})
+	}
+
 	if err := tx.Commit().Error; err != nil {
 		response.ApiError(c, http.StatusInternalServerError, "Failed to commit transaction: "+err.Error())
 		return
@@ -223,3 +211,159 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
 
 	response.SendResponse(c, http.StatusOK, true, "Profile updated successfully", updatedUser, nil)
 }
+
+// ChangePassword updates the authenticated user's password and signs out every other session
+func (h *UserHandler) ChangePassword(c *gin.Context) {
+	userInfo, err := helper.GetUserInfoFromContext(c)
+	if err != nil {
+		response.ApiError(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	req, err := helper.GetValidatedFromContext[validation.ChangePasswordRequest](c)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var user model.User
+	if err := h.db.DB().First(&user, userInfo.ID).Error; err != nil {
+		response.ApiError(c, http.StatusNotFound, "User not found")
+		return
+	}
+
+	// Verify the current password
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)); err != nil {
+		response.ApiError(c, http.StatusUnauthorized, "Current password is incorrect")
+		return
+	}
+
+	if req.CurrentPassword == req.NewPassword {
+		response.ApiError(c, http.StatusBadRequest, "New password must be different from the current password")
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to hash password", err.Error())
+		return
+	}
+
+	tx := h.db.DB().Begin()
+
+	if err := tx.Model(&user).Updates(map[string]interface{}{"password": string(hashedPassword), "has_temporary_password": false}).Error; err != nil {
+		tx.Rollback()
+		response.ApiError(c, http.StatusInternalServerError, "Failed to update password", err.Error())
+		return
+	}
+
+	// Revoke every refresh token except the ones of the current session's family
+	revokeQuery := tx.Where("user_id = ?", user.ID)
+	if currentRefreshToken, err := c.Cookie("GO_JWT"); err == nil && currentRefreshToken != "" {
+		var currentSession model.RefreshToken
+		if err := tx.Where("token_hash = ? AND user_id = ?", helper.HashToken(currentRefreshToken), user.ID).First(&currentSession).Error; err == nil {
+			revokeQuery = revokeQuery.Where("family_id <> ?", currentSession.FamilyID)
+		}
+	}
+	if err := revokeQuery.Delete(&model.RefreshToken{}).Error; err != nil {
+		tx.Rollback()
+		response.ApiError(c, http.StatusInternalServerError, "Failed to revoke sessions", err.Error())
+		return
+	}
+	audit.Record(c, tx, audit.Event{Action: model.AuditPasswordChanged})
+
+	if err := tx.Commit().Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to commit transaction: "+err.Error())
+		return
+	}
+
+	response.SendResponse(c, http.StatusOK, true, "Password changed successfully", gin.H{
+		"user_id": user.ID,
+	}, nil)
+}
+
+// SessionResponse describes an active session of the user
+type SessionResponse struct {
+	ID          uint       `json:"id"`
+	DeviceLabel string     `json:"device_label"`
+	UserAgent   string     `json:"user_agent"`
+	IP          string     `json:"ip"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	Current     bool       `json:"current"`
+}
+
+// GetSessions lists the active sessions of the authenticated user
+func (h *UserHandler) GetSessions(c *gin.Context) {
+	userInfo, err := helper.GetUserInfoFromContext(c)
+	if err != nil {
+		response.ApiError(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	// Only the latest token of each family is unused, so there is one row per session
+	var refreshTokens []model.RefreshToken
+	if err := h.db.DB().Where("user_id = ? AND used_at IS NULL AND expires_at > ?", userInfo.ID, time.Now()).Order("last_used_at DESC").Find(&refreshTokens).Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to fetch sessions", err.Error())
+		return
+	}
+
+	currentTokenHash := ""
+	if currentRefreshToken, err := c.Cookie("GO_JWT"); err == nil && currentRefreshToken != "" {
+		currentTokenHash = helper.HashToken(currentRefreshToken)
+	}
+
+	sessions := make([]SessionResponse, len(refreshTokens))
+	for i, refreshToken := range refreshTokens {
+		sessions[i] = SessionResponse{
+			ID:          refreshToken.ID,
+			DeviceLabel: refreshToken.DeviceLabel,
+			UserAgent:   refreshToken.UserAgent,
+			IP:          refreshToken.IP,
+			CreatedAt:   refreshToken.CreatedAt,
+			LastUsedAt:  refreshToken.LastUsedAt,
+			ExpiresAt:   refreshToken.ExpiresAt,
+			Current:     refreshToken.TokenHash == currentTokenHash,
+		}
+	}
+
+	response.SendResponse(c, http.StatusOK, true, "Sessions fetched successfully", sessions, nil)
+}
+
+// RevokeSession signs out a single session of the authenticated user
+func (h *UserHandler) RevokeSession(c *gin.Context) {
+	userInfo, err := helper.GetUserInfoFromContext(c)
+	if err != nil {
+		response.ApiError(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	sessionID := c.Param("id")
+	if sessionID == "" {
+		response.ApiError(c, http.StatusBadRequest, "Session id is required")
+		return
+	}
+
+	var refreshToken model.RefreshToken
+	if err := h.db.DB().Where("id = ? AND user_id = ? AND used_at IS NULL", sessionID, userInfo.ID).First(&refreshToken).Error; err != nil {
+		response.ApiError(c, http.StatusNotFound, "Session not found")
+		return
+	}
+
+	// Revoke the whole family so older tokens of the session can't be replayed either
+	if err := h.db.DB().Where("family_id = ? AND user_id = ?", refreshToken.FamilyID, userInfo.ID).Delete(&model.RefreshToken{}).Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to revoke session", err.Error())
+		return
+	}
+	audit.Record(c, h.db.DB(), audit.Event{Action: model.AuditSessionRevoked, Metadata: map[string]interface{}{"session_id": refreshToken.ID}})
+
+	// Clear the cookie when the caller revoked their own session
+	if currentRefreshToken, err := c.Cookie("GO_JWT"); err == nil && helper.HashToken(currentRefreshToken) == refreshToken.TokenHash {
+		clearRefreshTokenCookie(c)
+	}
+
+	response.SendResponse(c, http.StatusOK, true, "Session revoked successfully", gin.H{
+		"session_id": refreshToken.ID,
+	}, nil)
+}
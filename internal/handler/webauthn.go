@@ -0,0 +1,422 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"my-project/internal/database"
+	"my-project/internal/helper"
+	"my-project/internal/logger"
+	"my-project/internal/model"
+	"my-project/internal/response"
+	"my-project/internal/token"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// webauthnSessionCookie holds the id of the ceremony that is in progress
+const webauthnSessionCookie = "webauthn_session"
+
+// Ceremony names stored with a WebauthnSession
+const (
+	webauthnRegistration = "registration"
+	webauthnLogin        = "login"
+)
+
+type WebauthnHandler struct {
+	db       database.Service
+	tokens   token.Service
+	webauthn *webauthn.WebAuthn
+}
+
+func NewWebauthnHandler(db database.Service, tokens token.Service, webAuthn *webauthn.WebAuthn) *WebauthnHandler {
+	return &WebauthnHandler{db: db, tokens: tokens, webauthn: webAuthn}
+}
+
+// webauthnUser adapts a user and their registered credentials to the webauthn.User interface
+type webauthnUser struct {
+	user        *model.User
+	credentials []model.WebauthnCredential
+}
+
+// WebAuthnID is the user handle stored on the authenticator, it maps back to the user id
+func (u *webauthnUser) WebAuthnID() []byte {
+	return []byte(strconv.FormatUint(uint64(u.user.ID), 10))
+}
+
+func (u *webauthnUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *webauthnUser) WebAuthnDisplayName() string {
+	if u.user.Name != "" {
+		return u.user.Name
+	}
+	return u.user.Email
+}
+
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, len(u.credentials))
+	for i, record := range u.credentials {
+		var transports []protocol.AuthenticatorTransport
+		if record.Transports != "" {
+			for _, transport := range strings.Split(record.Transports, ",") {
+				transports = append(transports, protocol.AuthenticatorTransport(transport))
+			}
+		}
+
+		credentials[i] = webauthn.Credential{
+			ID:              record.CredentialID,
+			PublicKey:       record.PublicKey,
+			AttestationType: record.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				UserPresent:    record.UserPresent,
+				UserVerified:   record.UserVerified,
+				BackupEligible: record.BackupEligible,
+				BackupState:    record.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:     record.AAGUID,
+				SignCount:  record.SignCount,
+				Attachment: protocol.AuthenticatorAttachment(record.Attachment),
+			},
+		}
+	}
+	return credentials
+}
+
+// exclusions lists the registered credentials so an authenticator isn't registered twice
+func (u *webauthnUser) exclusions() []protocol.CredentialDescriptor {
+	descriptors := make([]protocol.CredentialDescriptor, 0, len(u.credentials))
+	for _, credential := range u.WebAuthnCredentials() {
+		descriptors = append(descriptors, credential.Descriptor())
+	}
+	return descriptors
+}
+
+// loadWebauthnUser fetches a user together with their registered credentials
+func loadWebauthnUser(db *gorm.DB, userID uint) (*webauthnUser, error) {
+	var user model.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	var credentials []model.WebauthnCredential
+	if err := db.Where("user_id = ?", userID).Find(&credentials).Error; err != nil {
+		return nil, err
+	}
+
+	return &webauthnUser{user: &user, credentials: credentials}, nil
+}
+
+// BeginRegistration starts registering a new passkey for the authenticated user
+func (h *WebauthnHandler) BeginRegistration(c *gin.Context) {
+	userInfo, err := helper.GetUserInfoFromContext(c)
+	if err != nil {
+		response.ApiError(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	user, err := loadWebauthnUser(h.db.DB(), userInfo.ID)
+	if err != nil {
+		response.ApiError(c, http.StatusNotFound, "User not found")
+		return
+	}
+
+	options, sessionData, err := h.webauthn.BeginRegistration(user, webauthn.WithExclusions(user.exclusions()))
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to start passkey registration", err.Error())
+		return
+	}
+
+	if err := h.saveCeremony(c, webauthnRegistration, &userInfo.ID, sessionData); err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to start passkey registration", err.Error())
+		return
+	}
+
+	response.SendResponse(c, http.StatusOK, true, "Passkey registration started", gin.H{
+		"options": options,
+	}, nil)
+}
+
+// FinishRegistration verifies the authenticator's attestation and stores the new passkey.
+// The body is the credential returned by navigator.credentials.create, an optional ?name= labels the passkey.
+func (h *WebauthnHandler) FinishRegistration(c *gin.Context) {
+	userInfo, err := helper.GetUserInfoFromContext(c)
+	if err != nil {
+		response.ApiError(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	ceremony, sessionData, err := h.consumeCeremony(c, webauthnRegistration)
+	if err != nil || ceremony.UserID == nil || *ceremony.UserID != userInfo.ID {
+		response.ApiError(c, http.StatusBadRequest, "Passkey registration expired, please start again")
+		return
+	}
+
+	user, err := loadWebauthnUser(h.db.DB(), userInfo.ID)
+	if err != nil {
+		response.ApiError(c, http.StatusNotFound, "User not found")
+		return
+	}
+
+	credential, err := h.webauthn.FinishRegistration(user, *sessionData, c.Request)
+	if err != nil {
+		response.ApiError(c, http.StatusBadRequest, "Passkey registration failed", webauthnErrorDetails(err))
+		return
+	}
+
+	name := strings.TrimSpace(c.Query("name"))
+	if name == "" {
+		name = helper.DeviceLabel(c.Request.UserAgent())
+	}
+
+	transports := make([]string, len(credential.Transport))
+	for i, transport := range credential.Transport {
+		transports[i] = string(transport)
+	}
+
+	record := model.WebauthnCredential{
+		UserID:          userInfo.ID,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		Transports:      strings.Join(transports, ","),
+		Attachment:      string(credential.Authenticator.Attachment),
+		UserPresent:     credential.Flags.UserPresent,
+		UserVerified:    credential.Flags.UserVerified,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+		Name:            helper.TruncateString(name, 255),
+	}
+	if err := h.db.DB().Create(&record).Error; err != nil {
+		response.ApiError(c, http.StatusConflict, "Passkey is already registered", err.Error())
+		return
+	}
+
+	response.SendResponse(c, http.StatusCreated, true, "Passkey registered successfully", record, nil)
+}
+
+// BeginLogin starts a passkey sign-in, the authenticator picks the account so no email is needed
+func (h *WebauthnHandler) BeginLogin(c *gin.Context) {
+	options, sessionData, err := h.webauthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to start passkey sign in", err.Error())
+		return
+	}
+
+	if err := h.saveCeremony(c, webauthnLogin, nil, sessionData); err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to start passkey sign in", err.Error())
+		return
+	}
+
+	response.SendResponse(c, http.StatusOK, true, "Passkey sign in started", gin.H{
+		"options": options,
+	}, nil)
+}
+
+// FinishLogin verifies the assertion and starts a session like SignIn does.
+// A user-verified passkey already combines possession and a local PIN or biometric, so no TOTP challenge follows.
+func (h *WebauthnHandler) FinishLogin(c *gin.Context) {
+	_, sessionData, err := h.consumeCeremony(c, webauthnLogin)
+	if err != nil {
+		response.ApiError(c, http.StatusBadRequest, "Passkey sign in expired, please start again")
+		return
+	}
+
+	assertion, err := protocol.ParseCredentialRequestResponse(c.Request)
+	if err != nil {
+		response.ApiError(c, http.StatusBadRequest, "Invalid passkey response", webauthnErrorDetails(err))
+		return
+	}
+
+	var owner *webauthnUser
+	findUser := func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID, err := strconv.ParseUint(string(userHandle), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user handle")
+		}
+		owner, err = loadWebauthnUser(h.db.DB(), uint(userID))
+		if err != nil {
+			return nil, err
+		}
+		return owner, nil
+	}
+
+	_, credential, err := h.webauthn.ValidatePasskeyLogin(findUser, *sessionData, assertion)
+	if err != nil {
+		response.ApiError(c, http.StatusUnauthorized, "Passkey sign in failed")
+		return
+	}
+
+	var record model.WebauthnCredential
+	if err := h.db.DB().Where("credential_id = ? AND user_id = ?", credential.ID, owner.user.ID).First(&record).Error; err != nil {
+		response.ApiError(c, http.StatusUnauthorized, "Passkey sign in failed")
+		return
+	}
+
+	// A signature counter that didn't move forward means the private key may have been copied
+	if credential.Authenticator.CloneWarning {
+		logger.ErrorLogger.Error("Security event: possible cloned passkey",
+			zap.Uint("user_id", record.UserID),
+			zap.Uint("credential_id", record.ID),
+			zap.Uint32("stored_sign_count", record.SignCount),
+			zap.String("ip", c.ClientIP()),
+			zap.String("user_agent", c.Request.UserAgent()),
+		)
+		response.ApiError(c, http.StatusUnauthorized, "Passkey sign in failed")
+		return
+	}
+
+	now := time.Now()
+	if err := h.db.DB().Model(&record).Updates(map[string]interface{}{
+		"sign_count":   credential.Authenticator.SignCount,
+		"backup_state": credential.Flags.BackupState,
+		"last_used_at": now,
+	}).Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to update passkey", err.Error())
+		return
+	}
+
+	if !allowAccountStatus(c, owner.user) {
+		return
+	}
+
+	// Start a new session
+	accessToken, err := issueSession(c, h.db.DB(), h.tokens, owner.user)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to create session", err.Error())
+		return
+	}
+
+	response.SendResponse(c, http.StatusOK, true, "Sign in successful", gin.H{
+		"access_token": accessToken,
+	}, nil)
+}
+
+// GetCredentials lists the passkeys of the authenticated user
+func (h *WebauthnHandler) GetCredentials(c *gin.Context) {
+	userInfo, err := helper.GetUserInfoFromContext(c)
+	if err != nil {
+		response.ApiError(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	var credentials []model.WebauthnCredential
+	if err := h.db.DB().Where("user_id = ?", userInfo.ID).Order("created_at DESC").Find(&credentials).Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to fetch passkeys", err.Error())
+		return
+	}
+
+	response.SendResponse(c, http.StatusOK, true, "Passkeys fetched successfully", credentials, nil)
+}
+
+// DeleteCredential removes a passkey of the authenticated user
+func (h *WebauthnHandler) DeleteCredential(c *gin.Context) {
+	userInfo, err := helper.GetUserInfoFromContext(c)
+	if err != nil {
+		response.ApiError(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	var credential model.WebauthnCredential
+	if err := h.db.DB().Where("id = ? AND user_id = ?", c.Param("id"), userInfo.ID).First(&credential).Error; err != nil {
+		response.ApiError(c, http.StatusNotFound, "Passkey not found")
+		return
+	}
+
+	loginMethods, err := countLoginMethods(h.db.DB(), userInfo.ID)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to check sign in methods", err.Error())
+		return
+	}
+	if loginMethods <= 1 {
+		response.ApiError(c, http.StatusConflict, "This is your last way to sign in, set a password or link an account first")
+		return
+	}
+
+	if err := h.db.DB().Delete(&credential).Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to delete passkey", err.Error())
+		return
+	}
+
+	response.SendResponse[any](c, http.StatusOK, true, "Passkey deleted successfully", nil, nil)
+}
+
+// saveCeremony stores the challenge of a ceremony and hands the browser an opaque cookie pointing at it
+func (h *WebauthnHandler) saveCeremony(c *gin.Context, ceremony string, userID *uint, sessionData *webauthn.SessionData) error {
+	data, err := json.Marshal(sessionData)
+	if err != nil {
+		return err
+	}
+
+	// Abandoned ceremonies are cleaned up whenever a new one starts
+	if err := h.db.DB().Where("expires_at < ?", time.Now()).Delete(&model.WebauthnSession{}).Error; err != nil {
+		return err
+	}
+
+	sessionID := helper.GenerateRandomString(43)
+	record := model.WebauthnSession{
+		SessionHash: helper.HashToken(sessionID),
+		UserID:      userID,
+		Ceremony:    ceremony,
+		Data:        string(data),
+		ExpiresAt:   sessionData.Expires,
+	}
+	if err := h.db.DB().Create(&record).Error; err != nil {
+		return err
+	}
+
+	c.SetCookie(webauthnSessionCookie, sessionID, int(time.Until(sessionData.Expires).Seconds()), "/", "", false, true)
+	return nil
+}
+
+// consumeCeremony loads the ceremony referenced by the cookie and deletes it, so every challenge is answered once
+func (h *WebauthnHandler) consumeCeremony(c *gin.Context, ceremony string) (*model.WebauthnSession, *webauthn.SessionData, error) {
+	sessionID, err := c.Cookie(webauthnSessionCookie)
+	if err != nil || sessionID == "" {
+		return nil, nil, errors.New("ceremony cookie not found")
+	}
+	c.SetCookie(webauthnSessionCookie, "", -1, "/", "", false, true)
+
+	var record model.WebauthnSession
+	if err := h.db.DB().Where("session_hash = ? AND ceremony = ?", helper.HashToken(sessionID), ceremony).First(&record).Error; err != nil {
+		return nil, nil, err
+	}
+
+	// Deleting by id only succeeds for one of two concurrent requests
+	result := h.db.DB().Delete(&model.WebauthnSession{}, record.ID)
+	if result.Error != nil {
+		return nil, nil, result.Error
+	}
+	if result.RowsAffected != 1 || record.ExpiresAt.Before(time.Now()) {
+		return nil, nil, errors.New("ceremony expired")
+	}
+
+	var sessionData webauthn.SessionData
+	if err := json.Unmarshal([]byte(record.Data), &sessionData); err != nil {
+		return nil, nil, err
+	}
+	return &record, &sessionData, nil
+}
+
+// webauthnErrorDetails returns the most descriptive message of a WebAuthn protocol error
+func webauthnErrorDetails(err error) string {
+	var protocolErr *protocol.Error
+	if errors.As(err, &protocolErr) && protocolErr.Details != "" {
+		return protocolErr.Details
+	}
+	return err.Error()
+}
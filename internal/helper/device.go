@@ -0,0 +1,57 @@
+package helper
+
+import (
+	"strings"
+)
+
+// DeviceLabel builds a short human readable label such as "Chrome on Windows" from a User-Agent header
+func DeviceLabel(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	if ua == "" {
+		return "Unknown device"
+	}
+
+	// Order matters: Edge and Opera also announce Chrome, Chrome also announces Safari
+	browser := "Unknown browser"
+	switch {
+	case strings.Contains(ua, "edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "opr/") || strings.Contains(ua, "opera"):
+		browser = "Opera"
+	case strings.Contains(ua, "firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "chrome/") || strings.Contains(ua, "crios/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "safari/"):
+		browser = "Safari"
+	case strings.Contains(ua, "curl/"):
+		browser = "curl"
+	case strings.Contains(ua, "postman"):
+		browser = "Postman"
+	}
+
+	// Mobile platforms first, Android and iOS user agents also mention Linux and Mac OS
+	os := "Unknown OS"
+	switch {
+	case strings.Contains(ua, "android"):
+		os = "Android"
+	case strings.Contains(ua, "iphone") || strings.Contains(ua, "ipad"):
+		os = "iOS"
+	case strings.Contains(ua, "windows"):
+		os = "Windows"
+	case strings.Contains(ua, "mac os"):
+		os = "macOS"
+	case strings.Contains(ua, "linux"):
+		os = "Linux"
+	}
+
+	return browser + " on " + os
+}
+
+// TruncateString cuts a string down to at most max bytes so it fits its column
+func TruncateString(value string, max int) string {
+	if len(value) <= max {
+		return value
+	}
+	return value[:max]
+}
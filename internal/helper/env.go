@@ -0,0 +1,16 @@
+package helper
+
+import (
+	"os"
+	"strconv"
+)
+
+// GetEnvInt64 reads an integer environment variable, falling back to the given default
+// when the variable is unset or not a valid integer
+func GetEnvInt64(key string, fallback int64) int64 {
+	value, err := strconv.ParseInt(os.Getenv(key), 10, 64)
+	if err != nil {
+		return fallback
+	}
+	return value
+}
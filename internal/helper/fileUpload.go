@@ -125,3 +125,13 @@ func UploadFileLocally(fileHeader *multipart.FileHeader, uploadDir string) (*Upl
 		ModifiedName: newFileName,
 	}, nil
 }
+
+// LocalFilePath turns the web path of a locally stored upload back into its path on disk.
+// It refuses paths that would point outside the upload directory.
+func LocalFilePath(webPath string) (string, error) {
+	diskPath := filepath.Join(".", filepath.FromSlash(webPath))
+	if !strings.HasPrefix(diskPath, "upload"+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is not an uploaded file", webPath)
+	}
+	return diskPath, nil
+}
@@ -3,6 +3,7 @@ package helper
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"math/big"
 )
 
 // GenerateRandomString generates a random string of specified length
@@ -13,3 +14,16 @@ func GenerateRandomString(length int) string {
 	}
 	return base64.URLEncoding.EncodeToString(b)[:length]
 }
+
+// GenerateNumericCode generates a random code of the given number of decimal digits
+func GenerateNumericCode(digits int) string {
+	code := make([]byte, digits)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			panic(err)
+		}
+		code[i] = byte('0' + n.Int64())
+	}
+	return string(code)
+}
@@ -3,8 +3,9 @@ package helper
 import (
 	"errors"
 
+	"my-project/internal/token"
+
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 )
 
 // UserInfo represents the user information from JWT claims
@@ -14,7 +15,7 @@ type UserInfo struct {
     Role  string `json:"role"`
 }
 
-// GetUserInfoFromContext extracts complete user info from JWT claims in Gin context
+// GetUserInfoFromContext extracts complete user info from the token claims in Gin context
 func GetUserInfoFromContext(c *gin.Context) (*UserInfo, error) {
     // Get user claims from context
     userData, exists := c.Get("user")
@@ -22,32 +23,16 @@ func GetUserInfoFromContext(c *gin.Context) (*UserInfo, error) {
         return nil, errors.New("user not authenticated")
     }
 
-    // Convert to JWT claims
-    claims, ok := userData.(jwt.MapClaims)
+    // Convert to token claims
+    claims, ok := userData.(*token.Claims)
     if !ok {
         return nil, errors.New("invalid user data format")
     }
 
-    // Extract user info fields
-    userIDFloat, ok := claims["id"].(float64)
-    if !ok {
-        return nil, errors.New("invalid user ID format")
-    }
-
-    email, ok := claims["email"].(string)
-    if !ok {
-        return nil, errors.New("invalid email format")
-    }
-
-    role, ok := claims["role"].(string)
-    if !ok {
-        return nil, errors.New("invalid role format")
-    }
-
     userInfo := &UserInfo{
-        ID:    uint(userIDFloat),
-        Email: email,
-        Role:  role,
+        ID:    claims.ID,
+        Email: claims.Email,
+        Role:  claims.Role,
     }
 
     return userInfo, nil
@@ -1,58 +1,118 @@
 package middleware
 
 import (
+	"fmt"
 	"net/http"
-	"os"
+	"slices"
 	"strings"
+	"time"
 
 	"my-project/internal/database"
+	"my-project/internal/helper"
 	"my-project/internal/model"
 	"my-project/internal/response"
+	"my-project/internal/token"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 )
 
-// AuthMiddleware creates a middleware for protecting routes and optionally checking user roles
-func AuthMiddleware(requiredRoles ...string) gin.HandlerFunc {
+// apiKeyLastUsedPrecision limits how often the last used time of a key is written
+const apiKeyLastUsedPrecision = time.Minute
+
+// AuthMiddleware creates a middleware for protecting routes, what the user may do is checked by RequirePermission.
+// Only signed-in sessions get through, API keys and impersonation tokens are refused; routes meant for them use ScopedAuthMiddleware.
+func AuthMiddleware() gin.HandlerFunc {
+	return authenticate("")
+}
+
+// ScopedAuthMiddleware protects a route that API keys carrying scope may call as well, sent in
+// `Authorization: Bearer` or `X-API-Key`. Sessions have every scope, impersonation tokens only the read scopes.
+func ScopedAuthMiddleware(scope string) gin.HandlerFunc {
+	return authenticate(scope)
+}
+
+// authenticate checks the caller, an empty scope limits the route to signed-in sessions
+func authenticate(scope string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Get authorization header
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			response.ApiError(c, http.StatusForbidden, "You are not authorized")
-			c.Abort()
-			return
-		}
+		db := c.MustGet("db").(database.Service)
 
-		// Check Bearer scheme
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			response.ApiError(c, http.StatusForbidden, "Invalid authorization format")
-			c.Abort()
-			return
-		}
+		var claims *token.Claims
+		if apiKey := apiKeyFromRequest(c); apiKey != "" {
+			if scope == "" {
+				response.ApiError(c, http.StatusForbidden, "API keys can't access this resource, please sign in")
+				c.Abort()
+				return
+			}
+			record, ok := authenticateAPIKey(c, db, apiKey)
+			if !ok {
+				c.Abort()
+				return
+			}
+			if !slices.Contains(strings.Split(record.Scopes, ","), scope) {
+				response.ApiError(c, http.StatusForbidden, fmt.Sprintf("API key is missing the %s scope", scope))
+				c.Abort()
+				return
+			}
+			// API keys act as their owner, with the same user info as a session
+			claims = &token.Claims{ID: record.User.ID, Email: record.User.Email, Role: string(record.User.Role)}
+		} else {
+			// Get authorization header
+			authHeader := c.GetHeader("Authorization")
+			if authHeader == "" {
+				response.ApiError(c, http.StatusForbidden, "You are not authorized")
+				c.Abort()
+				return
+			}
 
-		tokenString := parts[1]
+			// Check Bearer scheme
+			parts := strings.Split(authHeader, " ")
+			if len(parts) != 2 || parts[0] != "Bearer" {
+				response.ApiError(c, http.StatusForbidden, "Invalid authorization format")
+				c.Abort()
+				return
+			}
 
-		// Parse and validate token
-		claims := jwt.MapClaims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(os.Getenv("JWT_ACCESS_TOKEN_SECRET")), nil
-		})
+			tokenString := parts[1]
 
-		if err != nil || !token.Valid {
-			response.ApiError(c, http.StatusForbidden, "Invalid or expired token")
-			c.Abort()
-			return
+			// Parse and validate token
+			tokens := c.MustGet("tokens").(token.Verifier)
+			verified, err := tokens.Verify(token.Access, tokenString)
+			if err != nil {
+				response.ApiError(c, http.StatusForbidden, "Invalid or expired token")
+				c.Abort()
+				return
+			}
+
+			// Revoked tokens keep a valid signature until they expire, the denylist catches them
+			var revoked int64
+			if err := db.DB().Model(&model.RevokedToken{}).Where("jti = ?", verified.RegisteredClaims.ID).Count(&revoked).Error; err != nil {
+				response.ApiError(c, http.StatusInternalServerError, "Failed to check token", err.Error())
+				c.Abort()
+				return
+			}
+			if revoked > 0 {
+				response.ApiError(c, http.StatusForbidden, "Invalid or expired token")
+				c.Abort()
+				return
+			}
+			// Impersonation tokens may only read what the user could read
+			if verified.Act != nil && !model.IsReadScope(scope) {
+				response.ApiError(c, http.StatusForbidden, "This action is not allowed while impersonating a user")
+				c.Abort()
+				// The refused attempt is audited like every impersonated request
+				c.Set("user", verified)
+				recordImpersonatedRequest(c, db, verified)
+				return
+			}
+			claims = verified
 		}
 
 		// Get user ID from claims
-		userID := uint(claims["id"].(float64))
+		userID := claims.ID
 
-		// Check if user is verified
-		db := c.MustGet("db").(database.Service)
+		// Check if user is verified, the role is read as well since it may have changed after the token was issued
 		var user model.User
-		if err := db.DB().Select("is_verified").First(&user, userID).Error; err != nil {
+		if err := db.DB().Select("is_verified", "role", "status", "tokens_revoked_at").First(&user, userID).Error; err != nil {
 			response.ApiError(c, http.StatusNotFound, "User not found")
 			c.Abort()
 			return
@@ -64,33 +124,73 @@ func AuthMiddleware(requiredRoles ...string) gin.HandlerFunc {
 			return
 		}
 
-		// Check required roles if any
-		if len(requiredRoles) > 0 {
-			userRole, ok := claims["role"].(string)
-			if !ok {
-				response.ApiError(c, http.StatusForbidden, "Invalid token payload")
-				c.Abort()
-				return
-			}
+		// Disabled or banned accounts and tokens from before a forced sign out are refused
+		if !user.IsActive() {
+			response.ApiError(c, http.StatusForbidden, "This account has been "+string(user.Status))
+			c.Abort()
+			return
+		}
+		if claims.IssuedAt != nil && user.TokenRevoked(claims.IssuedAt.Time) {
+			response.ApiError(c, http.StatusForbidden, "Invalid or expired token")
+			c.Abort()
+			return
+		}
 
-			hasRole := false
-			for _, role := range requiredRoles {
-				if role == userRole {
-					hasRole = true
-					break
-				}
-			}
+		claims.Role = string(user.Role)
 
-			if !hasRole {
-				response.ApiError(c, http.StatusForbidden, "You have no access")
-				c.Abort()
-				return
-			}
+		// Impersonation tokens only work while the admin may still impersonate
+		if claims.Act != nil && !allowImpersonator(c, db, claims.Act) {
+			c.Abort()
+			return
 		}
 
 		// Store user info in context
 		c.Set("user", claims)
 		c.Next()
+
+		// Every request made while impersonating is recorded
+		if claims.Act != nil {
+			recordImpersonatedRequest(c, db, claims)
+		}
+	}
+}
+
+// apiKeyFromRequest returns the API key sent in X-API-Key or as a bearer token, if any
+func apiKeyFromRequest(c *gin.Context) string {
+	if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+		return apiKey
+	}
+	if apiKey, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "+model.APIKeyPrefix); ok {
+		return model.APIKeyPrefix + apiKey
+	}
+	return ""
+}
+
+// authenticateAPIKey looks up an unexpired key together with its owner and records its use
+func authenticateAPIKey(c *gin.Context, db database.Service, apiKey string) (*model.APIKey, bool) {
+	var record model.APIKey
+	if err := db.DB().Preload("User").Where("key_hash = ? AND (expires_at IS NULL OR expires_at > ?)", helper.HashToken(apiKey), time.Now()).First(&record).Error; err != nil {
+		response.ApiError(c, http.StatusForbidden, "Invalid or expired API key")
+		return nil, false
+	}
+
+	// Recording every request would be a write per call, a minute is precise enough
+	now := time.Now()
+	if err := db.DB().Model(&model.APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", record.ID, now.Add(-apiKeyLastUsedPrecision)).
+		Update("last_used_at", now).Error; err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to record API key use", err.Error())
+		return nil, false
+	}
+
+	return &record, true
+}
+
+// TokenMiddleware injects the token service into the context
+func TokenMiddleware(tokens token.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("tokens", tokens)
+		c.Next()
 	}
 }
 
@@ -0,0 +1,332 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"my-project/internal/logger"
+	"my-project/internal/model"
+	"my-project/internal/rbac"
+	"my-project/internal/token"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func TestMain(m *testing.M) {
+	// Error responses are logged, the tests don't need the log files
+	logger.AppLogger, logger.ErrorLogger = zap.NewNop(), zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// testDatabase serves a GORM connection backed by sqlmock
+type testDatabase struct {
+	db *gorm.DB
+}
+
+func (d *testDatabase) Health() map[string]string { return nil }
+func (d *testDatabase) Close() error              { return nil }
+func (d *testDatabase) DB() *gorm.DB              { return d.db }
+
+func newTestDatabase(t *testing.T) (*testDatabase, sqlmock.Sqlmock) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: conn, SkipInitializeWithVersion: true}), &gorm.Config{
+		Logger:                 gormlogger.Discard,
+		SkipDefaultTransaction: true,
+	})
+	if err != nil {
+		t.Fatalf("gorm: %v", err)
+	}
+	return &testDatabase{db: db}, mock
+}
+
+func testTokens() token.Service {
+	return token.New(token.Config{
+		Issuer:   "test-issuer",
+		Audience: "test-audience",
+		Kinds: map[token.Kind]token.KindConfig{
+			token.Access: {Secret: []byte("access-secret"), TTL: time.Minute},
+		},
+	})
+}
+
+// issueAccessToken signs in user 7
+func issueAccessToken(t *testing.T, tokens token.Service) string {
+	accessToken, _, err := tokens.Issue(token.Access, token.Subject{ID: 7, Email: "user@example.com", Role: "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return accessToken
+}
+
+// issueImpersonationToken signs in user 7 impersonated by admin 1
+func issueImpersonationToken(t *testing.T, tokens token.Service) string {
+	accessToken, _, err := tokens.Issue(token.Access, token.Subject{
+		ID: 7, Email: "user@example.com", Role: "user",
+		Actor: &token.Actor{ID: 1, Email: "admin@example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return accessToken
+}
+
+// testPermissions lets admins impersonate
+func testPermissions() *rbac.Service {
+	return rbac.New(func(role string) ([]string, error) {
+		if role == "admin" {
+			return []string{model.PermissionUsersImpersonate}, nil
+		}
+		return nil, nil
+	}, time.Minute)
+}
+
+// serve runs the request through auth and answers 200 with the authenticated user
+func serve(db *testDatabase, tokens token.Service, auth gin.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.Use(DatabaseMiddleware(db), TokenMiddleware(tokens), RBACMiddleware(testPermissions()))
+	r.GET("/", auth, func(c *gin.Context) {
+		claims := c.MustGet("user").(*token.Claims)
+		c.JSON(http.StatusOK, gin.H{"id": claims.ID})
+	})
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+// expectAPIKey expects the key lookup with its owner and the last used update
+func expectAPIKey(mock sqlmock.Sqlmock, scopes string) {
+	mock.ExpectQuery("FROM `apiKeys`").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "scopes"}).AddRow(3, 7, scopes))
+	mock.ExpectQuery("FROM `users`").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "role"}).AddRow(7, "user@example.com", "user"))
+	mock.ExpectExec("UPDATE `apiKeys`").WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+// expectDenylist expects the denylist lookup of an access token
+func expectDenylist(mock sqlmock.Sqlmock, revoked int) {
+	mock.ExpectQuery("FROM `revokedTokens`").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(revoked))
+}
+
+// expectVerifiedUser expects the account check of user 7
+func expectVerifiedUser(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery("FROM `users`").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "is_verified", "role"}).AddRow(7, true, "user"))
+}
+
+func TestAuthMiddlewareRefusesAPIKeys(t *testing.T) {
+	db, mock := newTestDatabase(t)
+
+	for _, header := range []string{"X-API-Key", "Authorization"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if header == "Authorization" {
+			req.Header.Set(header, "Bearer ak_secret")
+		} else {
+			req.Header.Set(header, "ak_secret")
+		}
+
+		rec := serve(db, testTokens(), AuthMiddleware(), req)
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("%s: got %d want 403", header, rec.Code)
+		}
+	}
+
+	// Session-only routes refuse keys before looking them up
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScopedAuthMiddlewareRequiresScope(t *testing.T) {
+	db, mock := newTestDatabase(t)
+	expectAPIKey(mock, "search:read,profile:read")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-API-Key", "ak_secret")
+
+	rec := serve(db, testTokens(), ScopedAuthMiddleware("search:write"), req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("got %d want 403", rec.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScopedAuthMiddlewareAcceptsKeyWithScope(t *testing.T) {
+	db, mock := newTestDatabase(t)
+	expectAPIKey(mock, "search:read,profile:read")
+	expectVerifiedUser(mock)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer ak_secret")
+
+	rec := serve(db, testTokens(), ScopedAuthMiddleware("profile:read"), req)
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"id":7}` {
+		t.Fatalf("got %d %s", rec.Code, rec.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuthMiddlewareAcceptsSession(t *testing.T) {
+	tokens := testTokens()
+	accessToken := issueAccessToken(t, tokens)
+
+	for _, auth := range []gin.HandlerFunc{AuthMiddleware(), ScopedAuthMiddleware("search:write")} {
+		db, mock := newTestDatabase(t)
+		expectDenylist(mock, 0)
+		expectVerifiedUser(mock)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+
+		rec := serve(db, tokens, auth, req)
+		if rec.Code != http.StatusOK || rec.Body.String() != `{"id":7}` {
+			t.Fatalf("got %d %s", rec.Code, rec.Body.String())
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAuthMiddlewareRefusesUnverifiedUser(t *testing.T) {
+	tokens := testTokens()
+	accessToken := issueAccessToken(t, tokens)
+
+	db, mock := newTestDatabase(t)
+	expectDenylist(mock, 0)
+	mock.ExpectQuery("FROM `users`").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "is_verified", "role"}).AddRow(7, false, "user"))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	rec := serve(db, tokens, AuthMiddleware(), req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("got %d want 403", rec.Code)
+	}
+}
+
+func TestAuthMiddlewareRefusesRevokedToken(t *testing.T) {
+	tokens := testTokens()
+	accessToken := issueAccessToken(t, tokens)
+
+	db, mock := newTestDatabase(t)
+	expectDenylist(mock, 1)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	rec := serve(db, tokens, AuthMiddleware(), req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("got %d want 403", rec.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuthMiddlewareRefusesTokenFromBeforeSignOut(t *testing.T) {
+	tokens := testTokens()
+	accessToken := issueAccessToken(t, tokens)
+
+	db, mock := newTestDatabase(t)
+	expectDenylist(mock, 0)
+	mock.ExpectQuery("FROM `users`").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "is_verified", "role", "status", "tokens_revoked_at"}).
+			AddRow(7, true, "user", "active", time.Now().Add(time.Minute)))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	rec := serve(db, tokens, AuthMiddleware(), req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("got %d want 403", rec.Code)
+	}
+}
+
+func TestAuthMiddlewareRefusesImpersonatedWrites(t *testing.T) {
+	tokens := testTokens()
+	accessToken := issueImpersonationToken(t, tokens)
+
+	for _, auth := range []gin.HandlerFunc{AuthMiddleware(), ScopedAuthMiddleware("search:write"), ScopedAuthMiddleware("profile:write")} {
+		db, mock := newTestDatabase(t)
+		expectDenylist(mock, 0)
+		// The refused request still ends up in the audit log
+		mock.ExpectExec("INSERT INTO `auditEvents`").WillReturnResult(sqlmock.NewResult(1, 1))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+
+		rec := serve(db, tokens, auth, req)
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("got %d want 403", rec.Code)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestScopedAuthMiddlewareAcceptsImpersonatedRead(t *testing.T) {
+	tokens := testTokens()
+	accessToken := issueImpersonationToken(t, tokens)
+
+	db, mock := newTestDatabase(t)
+	expectDenylist(mock, 0)
+	expectVerifiedUser(mock)
+	mock.ExpectQuery("FROM `users`").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "role", "status"}).AddRow(1, "admin", "active"))
+	mock.ExpectExec("INSERT INTO `auditEvents`").WillReturnResult(sqlmock.NewResult(1, 1))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	rec := serve(db, tokens, ScopedAuthMiddleware("profile:read"), req)
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"id":7}` {
+		t.Fatalf("got %d %s", rec.Code, rec.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuthMiddlewareRefusesImpersonationByDemotedAdmin(t *testing.T) {
+	tokens := testTokens()
+	accessToken := issueImpersonationToken(t, tokens)
+
+	db, mock := newTestDatabase(t)
+	expectDenylist(mock, 0)
+	expectVerifiedUser(mock)
+	mock.ExpectQuery("FROM `users`").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "role", "status"}).AddRow(1, "user", "active"))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	rec := serve(db, tokens, ScopedAuthMiddleware("search:read"), req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("got %d want 403", rec.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+
+	"my-project/internal/audit"
+	"my-project/internal/database"
+	"my-project/internal/model"
+	"my-project/internal/rbac"
+	"my-project/internal/response"
+	"my-project/internal/token"
+
+	"github.com/gin-gonic/gin"
+)
+
+// allowImpersonator checks that the admin behind an impersonation token may still impersonate,
+// so demoting or disabling them ends their impersonation right away
+func allowImpersonator(c *gin.Context, db database.Service, actor *token.Actor) bool {
+	var admin model.User
+	if err := db.DB().Select("role", "status").First(&admin, actor.ID).Error; err != nil || !admin.IsActive() {
+		response.ApiError(c, http.StatusForbidden, "Impersonation is no longer allowed")
+		return false
+	}
+
+	permissions := c.MustGet("rbac").(*rbac.Service)
+	allowed, err := permissions.HasPermission(string(admin.Role), model.PermissionUsersImpersonate)
+	if err != nil {
+		response.ApiError(c, http.StatusInternalServerError, "Failed to check permissions", err.Error())
+		return false
+	}
+	if !allowed {
+		response.ApiError(c, http.StatusForbidden, "Impersonation is no longer allowed")
+		return false
+	}
+	return true
+}
+
+// recordImpersonatedRequest writes a request made with an impersonation token to the audit log,
+// the user in the context is the actor and the admin its impersonator
+func recordImpersonatedRequest(c *gin.Context, db database.Service, claims *token.Claims) {
+	audit.Record(c, db.DB(), audit.Event{
+		Action: model.AuditImpersonatedRequest,
+		Metadata: map[string]interface{}{
+			"token_id": claims.RegisteredClaims.ID,
+			"method":   c.Request.Method,
+			"path":     c.Request.URL.Path,
+			"status":   c.Writer.Status(),
+		},
+	})
+}
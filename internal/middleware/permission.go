@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"my-project/internal/helper"
+	"my-project/internal/rbac"
+	"my-project/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission lets the request through when the caller's role grants the permission.
+// It must run after AuthMiddleware.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userInfo, err := helper.GetUserInfoFromContext(c)
+		if err != nil {
+			response.ApiError(c, http.StatusUnauthorized, err.Error())
+			c.Abort()
+			return
+		}
+
+		permissions := c.MustGet("rbac").(*rbac.Service)
+		allowed, err := permissions.HasPermission(userInfo.Role, permission)
+		if err != nil {
+			response.ApiError(c, http.StatusInternalServerError, "Failed to check permissions", err.Error())
+			c.Abort()
+			return
+		}
+		if !allowed {
+			response.ApiError(c, http.StatusForbidden, "You have no access", fmt.Sprintf("Missing permission %s", permission))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RBACMiddleware injects the permission service into the context
+func RBACMiddleware(permissions *rbac.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("rbac", permissions)
+		c.Next()
+	}
+}
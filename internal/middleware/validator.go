@@ -3,6 +3,7 @@ package middleware
 import (
 	"log"
 	"net/http"
+	"reflect"
 
 	"my-project/internal/response"
 
@@ -13,7 +14,12 @@ import (
 // ValidateRequest creates a middleware to validate the request body against a schema
 func ValidateRequest(schema interface{}, validate *validator.Validate) gin.HandlerFunc {
 	log.Print("ValidateRequest")
+	schemaType := reflect.TypeOf(schema).Elem()
 	return func(c *gin.Context) {
+		// Bind into a fresh copy per request, a shared instance would leak optional
+		// fields from one request into the next and race between concurrent requests
+		schema := reflect.New(schemaType).Interface()
+
 		// Bind JSON to schema
 		if err := c.ShouldBind(schema); err != nil {
 			response.ApiError(c, http.StatusBadRequest, "Invalid request payload", err.Error())
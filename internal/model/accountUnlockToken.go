@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+)
+
+// AccountUnlockToken model, emailed to the owner when their account gets locked after repeated failed sign-ins
+type AccountUnlockToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	TokenHash string     `gorm:"type:char(64);uniqueIndex;not null" json:"-"` // SHA-256 of the emailed token
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	// Relation
+	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// TableName overrides the table name for AccountUnlockToken
+func (AccountUnlockToken) TableName() string {
+	return "accountUnlockTokens"
+}
@@ -0,0 +1,43 @@
+package model
+
+import (
+	"time"
+)
+
+// APIKeyPrefix starts every API key, it tells keys apart from access tokens in the Authorization header
+const APIKeyPrefix = "ak_"
+
+// API key scopes, a key can only call routes that require one of its scopes
+const (
+	ScopeSearchRead   = "search:read"
+	ScopeSearchWrite  = "search:write"
+	ScopeProfileRead  = "profile:read"
+	ScopeProfileWrite = "profile:write"
+)
+
+// IsReadScope reports whether a route requiring scope only reads, impersonation tokens are limited to those
+func IsReadScope(scope string) bool {
+	return scope == ScopeSearchRead || scope == ScopeProfileRead
+}
+
+// APIKey model, a personal access token for scripted access. Only its hash is stored.
+type APIKey struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"index;not null" json:"user_id"`
+	Name       string     `gorm:"type:varchar(100);not null" json:"name"`
+	KeyHash    string     `gorm:"type:char(64);uniqueIndex;not null" json:"-"` // SHA-256 of the key
+	Prefix     string     `gorm:"type:varchar(16);not null" json:"prefix"`     // Start of the key so users can tell keys apart
+	Scopes     string     `gorm:"type:varchar(255);not null" json:"scopes"`    // Comma separated
+	ExpiresAt  *time.Time `json:"expires_at"`                                  // Nil never expires
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+
+	// Relation
+	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// TableName overrides the table name for APIKey
+func (APIKey) TableName() string {
+	return "apiKeys"
+}
@@ -0,0 +1,60 @@
+package model
+
+import (
+	"time"
+)
+
+// AuditAction names a security-relevant event, named area.event
+type AuditAction string
+
+const (
+	AuditSignUp              AuditAction = "auth.sign_up"
+	AuditSignIn              AuditAction = "auth.sign_in"
+	AuditSignInFailed        AuditAction = "auth.sign_in_failed"
+	AuditAccountLocked       AuditAction = "auth.account_locked"
+	AuditTokenRefreshed      AuditAction = "auth.token_refreshed"
+	AuditRefreshTokenReused  AuditAction = "auth.refresh_token_reused"
+	AuditSignOut             AuditAction = "auth.sign_out"
+	AuditSignOutAll          AuditAction = "auth.sign_out_all"
+	AuditPasswordReset       AuditAction = "auth.password_reset"
+	AuditSocialLinked        AuditAction = "oauth.linked"
+	AuditSocialUnlinked      AuditAction = "oauth.unlinked"
+	AuditProfileUpdated      AuditAction = "user.profile_updated"
+	AuditPasswordChanged     AuditAction = "user.password_changed"
+	AuditSessionRevoked      AuditAction = "user.session_revoked"
+	AuditMfaEnabled          AuditAction = "user.mfa_enabled"
+	AuditMfaDisabled         AuditAction = "user.mfa_disabled"
+	AuditAPIKeyCreated       AuditAction = "user.api_key_created"
+	AuditAPIKeyDeleted       AuditAction = "user.api_key_deleted"
+	AuditDataExported        AuditAction = "user.data_exported"
+	AuditAccountDeleted      AuditAction = "user.account_deleted"
+	AuditRoleCreated         AuditAction = "admin.role_created"
+	AuditRolePermissionsSet  AuditAction = "admin.role_permissions_set"
+	AuditRoleAssigned        AuditAction = "admin.role_assigned"
+	AuditUserVerified        AuditAction = "admin.user_verified"
+	AuditUserStatusChanged   AuditAction = "admin.user_status_changed"
+	AuditUserSignedOut       AuditAction = "admin.user_signed_out"
+	AuditUserDeleted         AuditAction = "admin.user_deleted"
+	AuditUserRestored        AuditAction = "admin.user_restored"
+	AuditImpersonation       AuditAction = "admin.impersonation_started"
+	AuditImpersonatedRequest AuditAction = "admin.impersonated_request"
+)
+
+// AuditEvent model, an append-only record of who did what to which account, from where
+type AuditEvent struct {
+	ID             uint                   `gorm:"primaryKey" json:"id"`
+	Action         AuditAction            `gorm:"type:varchar(64);index;not null" json:"action"`
+	ActorID        *uint                  `gorm:"index" json:"actor_id"`                          // Who acted, nil for anonymous callers
+	ImpersonatorID *uint                  `gorm:"index" json:"impersonator_id,omitempty"`         // Admin acting through an impersonation token
+	TargetID       *uint                  `gorm:"index" json:"target_id"`                         // Whose account the event concerns
+	Email          string                 `gorm:"type:varchar(255);index" json:"email,omitempty"` // For events without a known account
+	IP             string                 `gorm:"type:varchar(45);index" json:"ip"`
+	UserAgent      string                 `gorm:"type:varchar(512)" json:"user_agent"`
+	Metadata       map[string]interface{} `gorm:"serializer:json;type:json" json:"metadata,omitempty"`
+	CreatedAt      time.Time              `gorm:"index" json:"created_at"`
+}
+
+// TableName overrides the table name for AuditEvent
+func (AuditEvent) TableName() string {
+	return "auditEvents"
+}
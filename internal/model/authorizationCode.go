@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+)
+
+// AuthorizationCode model, a one-time code handed to the frontend after an OAuth redirect and swapped for tokens at /auth/exchange
+type AuthorizationCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	CodeHash  string     `gorm:"type:char(64);uniqueIndex;not null" json:"-"` // SHA-256 of the code in the redirect URL
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	// Relation
+	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// TableName overrides the table name for AuthorizationCode
+func (AuthorizationCode) TableName() string {
+	return "authorizationCodes"
+}
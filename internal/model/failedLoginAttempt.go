@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+)
+
+// FailedLoginAttempt model, one rejected sign-in used to throttle guessing per account and per IP.
+// Rows are keyed by the submitted email so unknown addresses are throttled exactly like real accounts.
+type FailedLoginAttempt struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Email     string    `gorm:"type:varchar(255);index;not null" json:"email"`
+	IP        string    `gorm:"type:varchar(45);index" json:"ip"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+// TableName overrides the table name for FailedLoginAttempt
+func (FailedLoginAttempt) TableName() string {
+	return "failedLoginAttempts"
+}
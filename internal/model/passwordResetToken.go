@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+)
+
+// PasswordResetToken model
+type PasswordResetToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	TokenHash string     `gorm:"type:char(64);uniqueIndex;not null" json:"-"` // SHA-256 of the emailed token
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	// Relation
+	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// TableName overrides the table name for PasswordResetToken
+func (PasswordResetToken) TableName() string {
+	return "passwordResetTokens"
+}
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+)
+
+// PendingSocialLink model, a provider identity waiting for a signed-in user to confirm linking it
+type PendingSocialLink struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	TokenHash  string    `gorm:"type:char(64);uniqueIndex;not null" json:"-"` // SHA-256 of the token kept in the link cookie
+	Provider   Provider  `gorm:"type:varchar(20);not null" json:"provider"`
+	ProviderID string    `gorm:"not null" json:"provider_id"`
+	Email      string    `gorm:"type:varchar(255)" json:"email"`
+	Name       string    `gorm:"size:255" json:"name"`
+	PhotoURL   string    `gorm:"size:2048" json:"photo_url"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// TableName overrides the table name for PendingSocialLink
+func (PendingSocialLink) TableName() string {
+	return "pendingSocialLinks"
+}
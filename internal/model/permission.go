@@ -0,0 +1,30 @@
+package model
+
+import (
+	"time"
+)
+
+// Permissions checked by the API, named resource:action[:scope]
+const (
+	PermissionSearchReadOwn    = "search:read:own"
+	PermissionSearchWriteOwn   = "search:write:own"
+	PermissionSearchReadAny    = "search:read:any"
+	PermissionRolesManage      = "roles:manage"
+	PermissionUsersRead        = "users:read"
+	PermissionUsersManage      = "users:manage"
+	PermissionUsersImpersonate = "users:impersonate"
+	PermissionAuditRead        = "audit:read"
+)
+
+// Permission model
+type Permission struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"type:varchar(100);uniqueIndex;not null" json:"name"`
+	Description string    `gorm:"type:varchar(255)" json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// TableName overrides the table name for Permission
+func (Permission) TableName() string {
+	return "permissions"
+}
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"time"
+)
+
+// PhoneOtpPurpose tells what an SMS code was sent for
+type PhoneOtpPurpose string
+
+const (
+	PhoneOtpVerify PhoneOtpPurpose = "verify"
+	PhoneOtpSignIn PhoneOtpPurpose = "signin"
+)
+
+// PhoneOtp model, a hashed one-time code sent by SMS
+type PhoneOtp struct {
+	ID          uint            `gorm:"primaryKey" json:"id"`
+	UserID      uint            `gorm:"index;not null" json:"user_id"`
+	PhoneNumber string          `gorm:"type:varchar(20);index;not null" json:"phone_number"` // Daily limits are counted per number
+	Purpose     PhoneOtpPurpose `gorm:"type:varchar(20);not null" json:"purpose"`
+	CodeHash    string          `gorm:"type:char(64);not null" json:"-"`
+	Attempts    int             `gorm:"default:0" json:"attempts"` // Wrong guesses so far
+	ExpiresAt   time.Time       `json:"expires_at"`
+	UsedAt      *time.Time      `json:"used_at"`
+	CreatedAt   time.Time       `json:"created_at"`
+
+	// Relation
+	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// TableName overrides the table name for PhoneOtp
+func (PhoneOtp) TableName() string {
+	return "phoneOtps"
+}
@@ -0,0 +1,22 @@
+package model
+
+import (
+	"time"
+)
+
+// RecoveryCode model, a hashed one-time code that replaces a TOTP code when the device is lost
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	CodeHash  string     `gorm:"type:char(64);not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	// Relation
+	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// TableName overrides the table name for RecoveryCode
+func (RecoveryCode) TableName() string {
+	return "recoveryCodes"
+}
@@ -5,12 +5,24 @@ import (
 )
 
 // RefreshToken model
+//
+// Every rotation creates a new row in the same family and marks the previous one as used.
+// Presenting a used token again means it was stolen, so the whole family gets revoked.
 type RefreshToken struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	Token     string    `gorm:"type:text;not null" json:"token"`
-	UserID    uint      `gorm:"index;not null" json:"user_id"`
-	CreatedAt time.Time `json:"created_at"`
-	ExpiresAt time.Time `json:"expires_at"`
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	TokenHash string     `gorm:"type:char(64);index;not null" json:"-"` // SHA-256 of the refresh JWT
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	FamilyID  string     `gorm:"type:char(36);index;not null" json:"family_id"`
+	ParentID  *uint      `gorm:"index" json:"parent_id"`
+	UsedAt    *time.Time `json:"used_at"`
+
+	// Session metadata, carried over on every rotation
+	UserAgent   string     `gorm:"type:varchar(512)" json:"user_agent"`
+	IP          string     `gorm:"type:varchar(45)" json:"ip"`
+	DeviceLabel string     `gorm:"type:varchar(100)" json:"device_label"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	CreatedAt   time.Time  `json:"created_at"` // Session start, kept across rotations
+	ExpiresAt   time.Time  `json:"expires_at"`
 
 	// Relation
 	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"user,omitempty"`
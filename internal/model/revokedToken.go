@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+)
+
+// RevokedToken model, the denylist of access tokens revoked before they expired.
+// Rows can be dropped once the token would have expired anyway.
+type RevokedToken struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	JTI       string    `gorm:"column:jti;type:char(36);uniqueIndex;not null" json:"jti"`
+	UserID    uint      `gorm:"index;not null" json:"user_id"`
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Relation
+	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// TableName overrides the table name for RevokedToken
+func (RevokedToken) TableName() string {
+	return "revokedTokens"
+}
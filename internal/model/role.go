@@ -0,0 +1,22 @@
+package model
+
+import (
+	"time"
+)
+
+// Role model, a named set of permissions. Users reference their role by name.
+type Role struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"type:varchar(50);uniqueIndex;not null" json:"name"`
+	Description string    `gorm:"type:varchar(255)" json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	// Relations
+	Permissions []Permission `gorm:"many2many:rolePermissions;constraint:OnDelete:CASCADE" json:"permissions,omitempty"`
+}
+
+// TableName overrides the table name for Role
+func (Role) TableName() string {
+	return "roles"
+}
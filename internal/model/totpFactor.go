@@ -0,0 +1,24 @@
+package model
+
+import (
+	"time"
+)
+
+// TotpFactor model, the authenticator app a user enrolled for two-factor authentication
+type TotpFactor struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	UserID       uint       `gorm:"uniqueIndex;not null" json:"user_id"`
+	Secret       string     `gorm:"type:varchar(64);not null" json:"-"` // Base32 shared secret
+	EnabledAt    *time.Time `json:"enabled_at"`                         // Nil until the user confirmed a code
+	LastUsedStep int64      `gorm:"default:0" json:"-"`                 // Time step of the last accepted code, blocks replays
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+
+	// Relation
+	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// TableName overrides the table name for TotpFactor
+func (TotpFactor) TableName() string {
+	return "totpFactors"
+}
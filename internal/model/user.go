@@ -6,13 +6,23 @@ import (
 	"gorm.io/gorm"
 )
 
-// UserRole defines the role enum
+// UserRole is the name of the user's row in the roles table
 type UserRole string
 
-// const (
-// 	RoleUser  UserRole = "user"
-// 	RoleAdmin UserRole = "admin"
-// )
+// Built-in roles, more can be created by admins
+const (
+	RoleUser  UserRole = "user"
+	RoleAdmin UserRole = "admin"
+)
+
+// UserStatus tells whether an account may sign in
+type UserStatus string
+
+const (
+	UserActive   UserStatus = "active"
+	UserDisabled UserStatus = "disabled" // Temporarily suspended by an admin
+	UserBanned   UserStatus = "banned"
+)
 
 // User model
 type User struct {
@@ -22,7 +32,13 @@ type User struct {
 	PhoneNumber string         `gorm:"type:varchar(20);index" json:"phone_number"`
 	Password    string         `gorm:"type:varchar(255);not null" json:"-"` // Hashed password
 	IsVerified  bool           `gorm:"default:false" json:"is_verified"`
-	Role        UserRole       `gorm:"type:varchar(20);default:user" json:"role"`
+	PhoneVerified bool         `gorm:"default:false" json:"phone_verified"` // Set once the user confirmed an SMS code
+	HasTemporaryPassword bool  `gorm:"default:false" json:"has_temporary_password"` // Only the random password emailed at social sign up is set
+	Role        UserRole       `gorm:"type:varchar(50);default:user" json:"role"` // Same length as roles.name
+	Status      UserStatus     `gorm:"type:varchar(20);default:active;index" json:"status"`
+	StatusReason string        `gorm:"type:varchar(255)" json:"status_reason"`
+	TokensRevokedAt *time.Time `json:"-"` // Access tokens issued before this are refused
+	PurgeAfter  *time.Time     `gorm:"index" json:"purge_after,omitempty"` // Set when the user deleted their account, rows and files are removed after it
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at"`
@@ -38,3 +54,13 @@ type User struct {
 func (User) TableName() string {
 	return "users"
 }
+
+// IsActive reports whether the account wasn't disabled or banned by an admin
+func (u *User) IsActive() bool {
+	return u.Status == "" || u.Status == UserActive
+}
+
+// TokenRevoked reports whether a token issued at issuedAt predates the user's last forced sign out
+func (u *User) TokenRevoked(issuedAt time.Time) bool {
+	return u.TokensRevokedAt != nil && issuedAt.Before(*u.TokensRevokedAt)
+}
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+)
+
+// VerificationEmail records every verification email sent or requested, used to throttle resends per address
+type VerificationEmail struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    *uint     `gorm:"index" json:"user_id"` // Nil for requests that sent nothing, so they are throttled alike
+	Email     string    `gorm:"type:varchar(255);index;not null" json:"email"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+
+	// Relation
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// TableName overrides the table name for VerificationEmail
+func (VerificationEmail) TableName() string {
+	return "verificationEmails"
+}
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"time"
+)
+
+// WebauthnCredential model, a passkey or security key the user registered for passwordless sign-in
+type WebauthnCredential struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	UserID          uint       `gorm:"index;not null" json:"user_id"`
+	CredentialID    []byte     `gorm:"type:varbinary(1023);uniqueIndex;not null" json:"-"` // Raw credential ID chosen by the authenticator
+	PublicKey       []byte     `gorm:"type:blob;not null" json:"-"`                        // COSE encoded public key
+	AttestationType string     `gorm:"type:varchar(32)" json:"-"`
+	AAGUID          []byte     `gorm:"type:varbinary(16)" json:"-"`
+	SignCount       uint32     `gorm:"default:0" json:"-"`
+	Transports      string     `gorm:"type:varchar(255)" json:"transports"` // Comma separated transport hints
+	Attachment      string     `gorm:"type:varchar(32)" json:"attachment"`
+	UserPresent     bool       `json:"-"`
+	UserVerified    bool       `json:"-"`
+	BackupEligible  bool       `json:"backup_eligible"`
+	BackupState     bool       `json:"backed_up"`
+	Name            string     `gorm:"type:varchar(255)" json:"name"`
+	LastUsedAt      *time.Time `json:"last_used_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+
+	// Relation
+	User User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// TableName overrides the table name for WebauthnCredential
+func (WebauthnCredential) TableName() string {
+	return "webauthnCredentials"
+}
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+)
+
+// WebauthnSession model, the challenge of a registration or sign-in ceremony that is still in progress
+type WebauthnSession struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	SessionHash string    `gorm:"type:char(64);uniqueIndex;not null" json:"-"` // SHA-256 of the id kept in the ceremony cookie
+	UserID      *uint     `gorm:"index" json:"user_id"`                        // Nil for discoverable sign-in
+	Ceremony    string    `gorm:"type:varchar(20);not null" json:"ceremony"`   // registration or login
+	Data        string    `gorm:"type:text;not null" json:"-"`                 // JSON encoded webauthn.SessionData
+	ExpiresAt   time.Time `json:"expires_at"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// TableName overrides the table name for WebauthnSession
+func (WebauthnSession) TableName() string {
+	return "webauthnSessions"
+}
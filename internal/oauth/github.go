@@ -0,0 +1,115 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
+)
+
+// GithubUser represents the profile returned by GitHub's /user API
+type GithubUser struct {
+	ID        int64  `json:"id"`
+	Login     string `json:"login"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+// GithubEmail represents an address returned by GitHub's /user/emails API
+type GithubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+// GithubProvider signs users in with their GitHub account
+type GithubProvider struct {
+	config *oauth2.Config
+}
+
+// NewGithubProvider completes the client config with GitHub's endpoint and scopes
+func NewGithubProvider(config *oauth2.Config) *GithubProvider {
+	config.Endpoint = github.Endpoint
+	config.Scopes = []string{"read:user", "user:email"}
+	return &GithubProvider{config: config}
+}
+
+func (p *GithubProvider) Name() string {
+	return "github"
+}
+
+func (p *GithubProvider) DisplayName() string {
+	return "GitHub"
+}
+
+func (p *GithubProvider) AuthCodeURL(state string, opts ...oauth2.AuthCodeOption) string {
+	return p.config.AuthCodeURL(state, opts...)
+}
+
+func (p *GithubProvider) Exchange(ctx context.Context, code string, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	return p.config.Exchange(ctx, code, opts...)
+}
+
+// UserInfo retrieves the profile and the primary email, which GitHub only lists on a separate endpoint
+func (p *GithubProvider) UserInfo(ctx context.Context, token *oauth2.Token) (*UserInfo, error) {
+	client := p.config.Client(ctx, token)
+
+	var user GithubUser
+	if err := githubGet(client, "https://api.github.com/user", &user); err != nil {
+		return nil, err
+	}
+
+	var emails []GithubEmail
+	if err := githubGet(client, "https://api.github.com/user/emails", &emails); err != nil {
+		return nil, err
+	}
+
+	info := &UserInfo{
+		ProviderID: strconv.FormatInt(user.ID, 10),
+		Name:       user.Name,
+		PictureURL: user.AvatarURL,
+	}
+	if info.Name == "" {
+		info.Name = user.Login
+	}
+	for _, email := range emails {
+		if email.Primary {
+			info.Email = email.Email
+			info.EmailVerified = email.Verified
+			break
+		}
+	}
+
+	return info, nil
+}
+
+// githubGet decodes a JSON response of the GitHub API
+func githubGet(client *http.Client, url string, target interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to get user info: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to get user info: %s", body)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return fmt.Errorf("failed to decode user info: %v", err)
+	}
+	return nil
+}
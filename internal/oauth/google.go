@@ -1,11 +1,11 @@
 package oauth
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
@@ -20,23 +20,68 @@ type GoogleUser struct {
 	Picture       string `json:"picture"`
 }
 
-// GoogleOAuthConfig returns a new OAuth2 config for Google
-func GoogleOAuthConfig() *oauth2.Config {
-	return &oauth2.Config{
-		ClientID:     getEnvOrPanic("GOOGLE_CLIENT_ID"),
-		ClientSecret: getEnvOrPanic("GOOGLE_CLIENT_SECRET"),
-		RedirectURL:  getEnvOrPanic("GOOGLE_REDIRECT_URL"),
-		Scopes: []string{
-			"https://www.googleapis.com/auth/userinfo.email",
-			"https://www.googleapis.com/auth/userinfo.profile",
-		},
-		Endpoint: google.Endpoint,
+// googleJWKSURL publishes the keys Google signs ID tokens with
+const googleJWKSURL = "https://www.googleapis.com/oauth2/v3/certs"
+
+// googleIssuers are the iss values Google puts in ID tokens
+var googleIssuers = []string{"https://accounts.google.com", "accounts.google.com"}
+
+// GoogleProvider signs users in with their Google account
+type GoogleProvider struct {
+	config   *oauth2.Config
+	idTokens *idTokenVerifier
+}
+
+// NewGoogleProvider completes the client config with Google's endpoint and OpenID Connect scopes
+func NewGoogleProvider(config *oauth2.Config) *GoogleProvider {
+	config.Endpoint = google.Endpoint
+	config.Scopes = []string{"openid", "email", "profile"}
+	return &GoogleProvider{
+		config:   config,
+		idTokens: newIDTokenVerifier(googleJWKSURL, googleIssuers, config.ClientID),
 	}
 }
 
-// GetGoogleUser retrieves the user's information from Google's OAuth2 API
-func GetGoogleUser(accessToken string) (*GoogleUser, error) {
-	resp, err := http.Get("https://www.googleapis.com/oauth2/v2/userinfo?access_token=" + accessToken)
+func (p *GoogleProvider) Name() string {
+	return "google"
+}
+
+func (p *GoogleProvider) DisplayName() string {
+	return "Google"
+}
+
+func (p *GoogleProvider) AuthCodeURL(state string, opts ...oauth2.AuthCodeOption) string {
+	return p.config.AuthCodeURL(state, opts...)
+}
+
+func (p *GoogleProvider) Exchange(ctx context.Context, code string, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	return p.config.Exchange(ctx, code, opts...)
+}
+
+// VerifyIDToken reads the user from the ID token Google returned with the access token
+func (p *GoogleProvider) VerifyIDToken(ctx context.Context, token *oauth2.Token, nonce string) (*UserInfo, error) {
+	raw, err := rawIDToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := p.idTokens.verify(ctx, raw, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserInfo{
+		ProviderID:    claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+		PictureURL:    claims.Picture,
+	}, nil
+}
+
+// UserInfo retrieves the user's information from Google's OAuth2 API
+func (p *GoogleProvider) UserInfo(ctx context.Context, token *oauth2.Token) (*UserInfo, error) {
+	resp, err := p.config.Client(ctx, token).Get("https://www.googleapis.com/oauth2/v2/userinfo")
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user info: %v", err)
 	}
@@ -52,14 +97,11 @@ func GetGoogleUser(accessToken string) (*GoogleUser, error) {
 		return nil, fmt.Errorf("failed to decode user info: %v", err)
 	}
 
-	return &user, nil
-}
-
-// getEnvOrPanic retrieves an environment variable or panics if it's not set
-func getEnvOrPanic(key string) string {
-	val := os.Getenv(key)
-	if val == "" {
-		panic(fmt.Sprintf("%s must be set", key))
-	}
-	return val
+	return &UserInfo{
+		ProviderID:    user.ID,
+		Email:         user.Email,
+		EmailVerified: user.VerifiedEmail,
+		Name:          user.Name,
+		PictureURL:    user.Picture,
+	}, nil
 }
@@ -0,0 +1,168 @@
+package oauth
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"my-project/internal/token"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+// jwksRefreshInterval bounds how often the provider keys are fetched, also when an unknown kid shows up
+const jwksRefreshInterval = time.Minute
+
+// jwksMaxAge is how long fetched keys are trusted before they are fetched again
+const jwksMaxAge = time.Hour
+
+// OIDCProvider is a provider returning a signed ID token. Its claims are verified locally
+// instead of trusting a userinfo API response.
+type OIDCProvider interface {
+	Provider
+	// VerifyIDToken checks signature, issuer, audience, expiry and nonce of the token's id_token
+	VerifyIDToken(ctx context.Context, token *oauth2.Token, nonce string) (*UserInfo, error)
+}
+
+// idTokenClaims are the OpenID Connect claims we read from an ID token
+type idTokenClaims struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	Picture       string `json:"picture"`
+	Nonce         string `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+// idTokenVerifier verifies ID tokens of one issuer for one client
+type idTokenVerifier struct {
+	jwksURL  string
+	issuers  []string
+	clientID string
+	client   *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+func newIDTokenVerifier(jwksURL string, issuers []string, clientID string) *idTokenVerifier {
+	return &idTokenVerifier{
+		jwksURL:  jwksURL,
+		issuers:  issuers,
+		clientID: clientID,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// verify validates a raw ID token and returns its claims
+func (v *idTokenVerifier) verify(ctx context.Context, rawIDToken, nonce string) (*idTokenClaims, error) {
+	if nonce == "" {
+		return nil, errors.New("missing nonce")
+	}
+
+	claims := &idTokenClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "EdDSA"}),
+		jwt.WithAudience(v.clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	if !slices.Contains(v.issuers, claims.Issuer) {
+		return nil, fmt.Errorf("invalid ID token: unexpected issuer %q", claims.Issuer)
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("invalid ID token: nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("invalid ID token: missing subject")
+	}
+
+	return claims, nil
+}
+
+// key returns the provider key with the given kid, fetching the key set when it is stale or the kid is unknown
+func (v *idTokenVerifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	key, ok := v.keys[kid]
+	stale := time.Since(v.fetchedAt) > jwksMaxAge
+	if ok && !stale {
+		return key, nil
+	}
+
+	if stale || time.Since(v.fetchedAt) > jwksRefreshInterval {
+		if err := v.fetch(ctx); err != nil {
+			return nil, err
+		}
+		key, ok = v.keys[kid]
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// fetch downloads the provider's JSON Web Key Set
+func (v *idTokenVerifier) fetch(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.jwksURL, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch provider keys: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch provider keys: status %d", resp.StatusCode)
+	}
+
+	var jwks token.JWKS
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return fmt.Errorf("failed to decode provider keys: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			// Skip key types we can't use rather than failing the whole set
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	v.keys = keys
+	v.fetchedAt = time.Now()
+	return nil
+}
+
+// rawIDToken extracts the id_token the token endpoint returned next to the access token
+func rawIDToken(token *oauth2.Token) (string, error) {
+	raw, ok := token.Extra("id_token").(string)
+	if !ok || raw == "" {
+		return "", errors.New("token response has no id_token")
+	}
+	return raw, nil
+}
@@ -0,0 +1,124 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"my-project/internal/token"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func testVerifier(t *testing.T) (*idTokenVerifier, *rsa.PrivateKey) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := token.JWKS{Keys: []token.JWK{{
+		Kty: "RSA",
+		Kid: "key-1",
+		Use: "sig",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jwks)
+	}))
+	t.Cleanup(server.Close)
+
+	return newIDTokenVerifier(server.URL, []string{"https://issuer.test"}, "client-id"), key
+}
+
+func signIDToken(t *testing.T, key *rsa.PrivateKey, kid string, claims idTokenClaims) string {
+	t.Helper()
+
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	tok.Header["kid"] = kid
+	raw, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func validClaims() idTokenClaims {
+	now := time.Now()
+	return idTokenClaims{
+		Email:         "user@example.com",
+		EmailVerified: true,
+		Nonce:         "nonce-1",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "https://issuer.test",
+			Subject:   "12345",
+			Audience:  jwt.ClaimStrings{"client-id"},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	verifier, key := testVerifier(t)
+
+	claims, err := verifier.verify(context.Background(), signIDToken(t, key, "key-1", validClaims()), "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "12345" || claims.Email != "user@example.com" || !claims.EmailVerified {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+}
+
+func TestVerifyIDTokenRejects(t *testing.T) {
+	verifier, key := testVerifier(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		raw   func() string
+		nonce string
+	}{
+		{"nonce mismatch", func() string { return signIDToken(t, key, "key-1", validClaims()) }, "other-nonce"},
+		{"missing nonce", func() string { return signIDToken(t, key, "key-1", validClaims()) }, ""},
+		{"wrong audience", func() string {
+			claims := validClaims()
+			claims.Audience = jwt.ClaimStrings{"other-client"}
+			return signIDToken(t, key, "key-1", claims)
+		}, "nonce-1"},
+		{"wrong issuer", func() string {
+			claims := validClaims()
+			claims.Issuer = "https://evil.test"
+			return signIDToken(t, key, "key-1", claims)
+		}, "nonce-1"},
+		{"expired", func() string {
+			claims := validClaims()
+			claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+			return signIDToken(t, key, "key-1", claims)
+		}, "nonce-1"},
+		{"foreign signature", func() string { return signIDToken(t, otherKey, "key-1", validClaims()) }, "nonce-1"},
+		{"unknown key", func() string { return signIDToken(t, key, "key-2", validClaims()) }, "nonce-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := verifier.verify(context.Background(), tt.raw(), tt.nonce); err == nil {
+				t.Fatal("expected the ID token to be rejected")
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"golang.org/x/oauth2"
+)
+
+// UserInfo is the provider independent profile of the user who signed in
+type UserInfo struct {
+	ProviderID    string
+	Email         string
+	EmailVerified bool
+	Name          string
+	PictureURL    string
+}
+
+// Provider is an OAuth2 identity provider users can sign in with
+type Provider interface {
+	// Name is the identifier used in routes and stored on social profiles, e.g. "google"
+	Name() string
+	// DisplayName is shown to users, e.g. "Google"
+	DisplayName() string
+	// AuthCodeURL returns the consent page URL to redirect the user to
+	AuthCodeURL(state string, opts ...oauth2.AuthCodeOption) string
+	// Exchange trades the authorization code from the callback for a token
+	Exchange(ctx context.Context, code string, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error)
+	// UserInfo fetches the profile of the token owner
+	UserInfo(ctx context.Context, token *oauth2.Token) (*UserInfo, error)
+}
+
+// Registry holds the configured providers by name
+type Registry struct {
+	providers map[string]Provider
+}
+
+// NewRegistry creates a registry of the given providers
+func NewRegistry(providers ...Provider) *Registry {
+	r := &Registry{providers: make(map[string]Provider, len(providers))}
+	for _, provider := range providers {
+		r.providers[provider.Name()] = provider
+	}
+	return r
+}
+
+// Get returns the provider with the given name
+func (r *Registry) Get(name string) (Provider, bool) {
+	provider, ok := r.providers[name]
+	return provider, ok
+}
+
+// Names lists the configured providers in alphabetical order
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RegistryFromEnv registers every provider whose <NAME>_CLIENT_ID is set.
+// A provider with a client id but missing secret or redirect URL is a configuration error.
+func RegistryFromEnv() (*Registry, error) {
+	var providers []Provider
+
+	if config, err := configFromEnv("GOOGLE"); err != nil {
+		return nil, err
+	} else if config != nil {
+		providers = append(providers, NewGoogleProvider(config))
+	}
+
+	if config, err := configFromEnv("GITHUB"); err != nil {
+		return nil, err
+	} else if config != nil {
+		providers = append(providers, NewGithubProvider(config))
+	}
+
+	return NewRegistry(providers...), nil
+}
+
+// configFromEnv reads <PREFIX>_CLIENT_ID, <PREFIX>_CLIENT_SECRET and <PREFIX>_REDIRECT_URL.
+// It returns nil when the provider isn't configured at all.
+func configFromEnv(prefix string) (*oauth2.Config, error) {
+	clientID := os.Getenv(prefix + "_CLIENT_ID")
+	if clientID == "" {
+		return nil, nil
+	}
+
+	config := &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: os.Getenv(prefix + "_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv(prefix + "_REDIRECT_URL"),
+	}
+	if config.ClientSecret == "" || config.RedirectURL == "" {
+		return nil, fmt.Errorf("%s_CLIENT_SECRET and %s_REDIRECT_URL must be set when %s_CLIENT_ID is", prefix, prefix, prefix)
+	}
+	return config, nil
+}
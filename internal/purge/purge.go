@@ -0,0 +1,147 @@
+package purge
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"my-project/internal/helper"
+	"my-project/internal/logger"
+	"my-project/internal/model"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// userTables are deleted by user_id when an account is purged. Tables whose rows hang off
+// these ones (responses, images) are handled separately.
+var userTables = []interface{}{
+	&model.Search{},
+	&model.UserDetail{},
+	&model.SocialProfile{},
+	&model.RefreshToken{},
+	&model.APIKey{},
+	&model.TotpFactor{},
+	&model.RecoveryCode{},
+	&model.WebauthnCredential{},
+	&model.WebauthnSession{},
+	&model.AccountUnlockToken{},
+	&model.PasswordResetToken{},
+	&model.VerificationEmail{},
+	&model.AuthorizationCode{},
+	&model.MagicLinkToken{},
+	&model.PhoneOtp{},
+	&model.RevokedToken{},
+}
+
+// Purger hard-deletes accounts whose owners deleted them once their grace period is over
+type Purger struct {
+	db       *gorm.DB
+	interval time.Duration
+}
+
+// New creates a purger checking for due accounts every interval
+func New(db *gorm.DB, interval time.Duration) *Purger {
+	return &Purger{db: db, interval: interval}
+}
+
+// FromEnv creates a purger running every ACCOUNT_PURGE_INTERVAL seconds
+func FromEnv(db *gorm.DB) *Purger {
+	return New(db, time.Second*time.Duration(helper.GetEnvInt64("ACCOUNT_PURGE_INTERVAL", 3600)))
+}
+
+// Run purges due accounts right away and then every interval until ctx is done
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := p.PurgeDue(time.Now())
+		if err != nil {
+			logger.ErrorLogger.Error("Failed to purge deleted accounts", zap.Error(err), zap.Int("purged", purged))
+		} else if purged > 0 {
+			logger.AppLogger.Info("Purged deleted accounts", zap.Int("purged", purged))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeDue purges every deleted account whose grace period ended before now and reports how many it purged
+func (p *Purger) PurgeDue(now time.Time) (int, error) {
+	var users []model.User
+	if err := p.db.Unscoped().Where("deleted_at IS NOT NULL AND purge_after <= ?", now).Find(&users).Error; err != nil {
+		return 0, err
+	}
+
+	var errs []error
+	purged := 0
+	for i := range users {
+		if err := PurgeUser(p.db, &users[i]); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		purged++
+	}
+	return purged, errors.Join(errs...)
+}
+
+// PurgeUser removes the user, every row that belongs to them and their uploaded files. Audit events about
+// the account go as well; events where they acted on other accounts keep only their former ID.
+func PurgeUser(db *gorm.DB, user *model.User) error {
+	var images []model.Image
+	if err := db.Where("user_detail_id IN (?)", db.Model(&model.UserDetail{}).Select("id").Where("user_id = ?", user.ID)).Find(&images).Error; err != nil {
+		return err
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("search_id IN (?)", tx.Unscoped().Model(&model.Search{}).Select("id").Where("user_id = ?", user.ID)).Delete(&model.Response{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_detail_id IN (?)", tx.Model(&model.UserDetail{}).Select("id").Where("user_id = ?", user.ID)).Delete(&model.Image{}).Error; err != nil {
+			return err
+		}
+		for _, table := range userTables {
+			if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(table).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("target_id = ?", user.ID).Delete(&model.AuditEvent{}).Error; err != nil {
+			return err
+		}
+		// Resend throttling rows of the email aren't tied to the user
+		if err := tx.Where("email = ?", user.Email).Delete(&model.VerificationEmail{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("email = ?", user.Email).Delete(&model.FailedLoginAttempt{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(user).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	// Files go once the rows are gone, a leftover file is logged rather than undoing the purge
+	for _, image := range images {
+		if image.DiskType != model.DiskTypeLocal {
+			continue
+		}
+		path, err := helper.LocalFilePath(image.Path)
+		if err == nil {
+			err = os.Remove(path)
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.ErrorLogger.Error("Failed to remove file of purged user",
+				zap.Error(err),
+				zap.Uint("user_id", user.ID),
+				zap.String("path", image.Path))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreBucket(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	limit := Limit{Requests: 3, Period: 3 * time.Second}
+
+	for i := 2; i >= 0; i-- {
+		result, err := store.Take(context.Background(), "ip:1", limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Allowed || result.Remaining != i {
+			t.Fatalf("request %d: got allowed=%v remaining=%d", 3-i, result.Allowed, result.Remaining)
+		}
+	}
+
+	result, _ := store.Take(context.Background(), "ip:1", limit)
+	if result.Allowed {
+		t.Fatal("fourth request should be limited")
+	}
+	if result.RetryAfter != time.Second {
+		t.Fatalf("retry after: got %v want 1s", result.RetryAfter)
+	}
+
+	// Other keys have their own bucket
+	if result, _ := store.Take(context.Background(), "ip:2", limit); !result.Allowed {
+		t.Fatal("other key should not be limited")
+	}
+
+	// One token refills per second
+	now = now.Add(time.Second)
+	if result, _ := store.Take(context.Background(), "ip:1", limit); !result.Allowed || result.Remaining != 0 {
+		t.Fatalf("after refill: got allowed=%v remaining=%d", result.Allowed, result.Remaining)
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	limit := Limit{Requests: 10, Period: time.Minute}
+
+	store.Take(context.Background(), "ip:1", limit)
+	now = now.Add(2 * sweepInterval)
+	store.Take(context.Background(), "ip:2", limit)
+
+	if _, ok := store.buckets["ip:1"]; ok {
+		t.Fatal("refilled bucket should have been swept")
+	}
+	if _, ok := store.buckets["ip:2"]; !ok {
+		t.Fatal("active bucket should be kept")
+	}
+}
@@ -0,0 +1,85 @@
+// Package ratelimit implements token bucket rate limiting with pluggable state stores.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"my-project/internal/helper"
+)
+
+// Limit describes a token bucket: Requests tokens that refill evenly over Period
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// rate returns how many tokens are added per second
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// Result is the outcome of taking a token from a bucket
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration // Time until a token is available, zero when allowed
+	ResetAfter time.Duration // Time until the bucket is full again
+}
+
+// Store keeps bucket state. Implementations must make Take atomic per key.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// newResult derives the headers' values from the tokens left in a bucket
+func newResult(limit Limit, tokens float64, allowed bool) Result {
+	rate := limit.rate()
+	result := Result{
+		Allowed:    allowed,
+		Limit:      limit.Requests,
+		Remaining:  int(math.Floor(tokens)),
+		ResetAfter: time.Duration((float64(limit.Requests) - tokens) / rate * float64(time.Second)),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) / rate * float64(time.Second))
+	}
+	return result
+}
+
+// LimitFromEnv reads RATE_LIMIT_<NAME>_REQUESTS and RATE_LIMIT_<NAME>_PERIOD (seconds),
+// falling back to the given defaults. Values below one are refused: a zero period would refill
+// without bound and an empty bucket would deny every request.
+func LimitFromEnv(name string, requests int, period time.Duration) (Limit, error) {
+	prefix := "RATE_LIMIT_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+	limit := Limit{
+		Requests: int(helper.GetEnvInt64(prefix+"_REQUESTS", int64(requests))),
+		Period:   time.Second * time.Duration(helper.GetEnvInt64(prefix+"_PERIOD", int64(period.Seconds()))),
+	}
+	if limit.Requests <= 0 {
+		return Limit{}, fmt.Errorf("%s_REQUESTS must be positive, got %d", prefix, limit.Requests)
+	}
+	if limit.Period <= 0 {
+		return Limit{}, fmt.Errorf("%s_PERIOD must be positive, got %s", prefix, limit.Period)
+	}
+	return limit, nil
+}
+
+// StoreFromEnv returns a Redis store when RATE_LIMIT_REDIS_URL is set and an in-memory store otherwise
+func StoreFromEnv() (Store, error) {
+	redisURL := os.Getenv("RATE_LIMIT_REDIS_URL")
+	if redisURL == "" {
+		return NewMemoryStore(), nil
+	}
+
+	store, err := NewRedisStore(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RATE_LIMIT_REDIS_URL: %w", err)
+	}
+	return store, nil
+}
@@ -0,0 +1,31 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimitFromEnv(t *testing.T) {
+	t.Setenv("RATE_LIMIT_TEST_REQUESTS", "20")
+
+	limit, err := LimitFromEnv("test", 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limit.Requests != 20 || limit.Period != time.Minute {
+		t.Fatalf("unexpected limit: %+v", limit)
+	}
+}
+
+func TestLimitFromEnvRejectsNonPositive(t *testing.T) {
+	for _, env := range []string{"RATE_LIMIT_TEST_REQUESTS", "RATE_LIMIT_TEST_PERIOD"} {
+		for _, value := range []string{"0", "-5"} {
+			t.Run(env+"="+value, func(t *testing.T) {
+				t.Setenv(env, value)
+				if _, err := LimitFromEnv("test", 10, time.Minute); err == nil {
+					t.Fatal("expected an error")
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript refills and takes from a bucket stored as a hash in one atomic step.
+// The key expires once the bucket would be full again.
+var takeScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local state = redis.call("HMGET", KEYS[1], "tokens", "updated_at")
+local tokens = tonumber(state[1]) or capacity
+local updated_at = tonumber(state[2]) or now
+
+tokens = math.min(capacity, tokens + math.max(0, now - updated_at) / 1000 * rate)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "updated_at", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil((capacity - tokens) / rate * 1000) + 1000)
+
+return {allowed, tostring(tokens)}
+`)
+
+// RedisStore keeps buckets in Redis (or any server speaking its protocol) so limits are shared between instances
+type RedisStore struct {
+	client redis.Scripter
+	prefix string
+}
+
+// NewRedisStore connects to the server at a redis:// or rediss:// URL
+func NewRedisStore(url string) (*RedisStore, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisStore{client: redis.NewClient(options), prefix: "ratelimit:"}, nil
+}
+
+// Take runs the token bucket script for the key
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	values, err := takeScript.Run(ctx, s.client, []string{s.prefix + key},
+		limit.Requests, limit.rate(), time.Now().UnixMilli()).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	allowed, _ := values[0].(int64)
+	tokensValue, _ := values[1].(string)
+	tokens, err := strconv.ParseFloat(tokensValue, 64)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return newResult(limit, tokens, allowed == 1), nil
+}
@@ -0,0 +1,95 @@
+// Package rbac resolves the permissions of a role, caching them for a short time.
+package rbac
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"my-project/internal/helper"
+	"my-project/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// Loader returns the permission names granted to a role
+type Loader func(role string) ([]string, error)
+
+type cacheEntry struct {
+	permissions []string
+	loadedAt    time.Time
+}
+
+// Service answers permission checks. Changes made through this instance are visible
+// immediately, changes made elsewhere once the cache entry expires.
+type Service struct {
+	load Loader
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu    sync.RWMutex
+	cache map[string]cacheEntry
+}
+
+func New(load Loader, ttl time.Duration) *Service {
+	return &Service{
+		load:  load,
+		ttl:   ttl,
+		now:   time.Now,
+		cache: map[string]cacheEntry{},
+	}
+}
+
+// ServiceFromEnv loads permissions from the database and caches them for RBAC_CACHE_TTL seconds (default 60)
+func ServiceFromEnv(db *gorm.DB) *Service {
+	return New(LoaderFromDB(db), time.Second*time.Duration(helper.GetEnvInt64("RBAC_CACHE_TTL", 60)))
+}
+
+// LoaderFromDB reads the permissions of a role from the roles, rolePermissions and permissions tables
+func LoaderFromDB(db *gorm.DB) Loader {
+	return func(role string) ([]string, error) {
+		var permissions []string
+		err := db.Model(&model.Permission{}).
+			Joins("JOIN rolePermissions ON rolePermissions.permission_id = permissions.id").
+			Joins("JOIN roles ON roles.id = rolePermissions.role_id").
+			Where("roles.name = ?", role).
+			Pluck("permissions.name", &permissions).Error
+		return permissions, err
+	}
+}
+
+// Permissions returns the permissions granted to a role, an unknown role has none
+func (s *Service) Permissions(role string) ([]string, error) {
+	s.mu.RLock()
+	entry, ok := s.cache[role]
+	s.mu.RUnlock()
+	if ok && s.now().Sub(entry.loadedAt) < s.ttl {
+		return entry.permissions, nil
+	}
+
+	permissions, err := s.load(role)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.cache[role] = cacheEntry{permissions: permissions, loadedAt: s.now()}
+	s.mu.Unlock()
+	return permissions, nil
+}
+
+// HasPermission reports whether the role grants the permission
+func (s *Service) HasPermission(role, permission string) (bool, error) {
+	permissions, err := s.Permissions(role)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(permissions, permission), nil
+}
+
+// Invalidate drops all cached permissions, call it after changing roles or their permissions
+func (s *Service) Invalidate() {
+	s.mu.Lock()
+	s.cache = map[string]cacheEntry{}
+	s.mu.Unlock()
+}
@@ -0,0 +1,69 @@
+package rbac
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestServiceCachesPermissions(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	loads := 0
+	grants := map[string][]string{"admin": {"search:read:any", "roles:manage"}}
+	service := New(func(role string) ([]string, error) {
+		loads++
+		return grants[role], nil
+	}, time.Minute)
+	service.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		ok, err := service.HasPermission("admin", "roles:manage")
+		if err != nil || !ok {
+			t.Fatalf("admin should have roles:manage, got %v %v", ok, err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("loads: got %d want 1", loads)
+	}
+
+	// Unknown roles and missing permissions are denied
+	if ok, _ := service.HasPermission("admin", "search:write:own"); ok {
+		t.Fatal("admin should not have search:write:own")
+	}
+	if ok, _ := service.HasPermission("guest", "roles:manage"); ok {
+		t.Fatal("unknown role should have no permissions")
+	}
+
+	// Changes show up once the entry expires
+	grants["admin"] = []string{"search:read:any"}
+	now = now.Add(time.Minute)
+	if ok, _ := service.HasPermission("admin", "roles:manage"); ok {
+		t.Fatal("revoked permission should be gone after the TTL")
+	}
+
+	// Or right away after invalidating
+	grants["admin"] = []string{"roles:manage"}
+	service.Invalidate()
+	if ok, _ := service.HasPermission("admin", "roles:manage"); !ok {
+		t.Fatal("granted permission should show up after invalidating")
+	}
+}
+
+func TestServiceDoesNotCacheErrors(t *testing.T) {
+	fail := true
+	service := New(func(role string) ([]string, error) {
+		if fail {
+			return nil, errors.New("database down")
+		}
+		return []string{"roles:manage"}, nil
+	}, time.Minute)
+
+	if _, err := service.HasPermission("admin", "roles:manage"); err == nil {
+		t.Fatal("expected the loader error")
+	}
+
+	fail = false
+	if ok, err := service.HasPermission("admin", "roles:manage"); err != nil || !ok {
+		t.Fatalf("expected a fresh load after an error, got %v %v", ok, err)
+	}
+}
@@ -2,60 +2,137 @@ package server
 
 import (
 	"my-project/internal/handler"
+	"my-project/internal/logger"
 	"my-project/internal/middleware"
+	"my-project/internal/model"
 	"my-project/internal/validation"
 	"net/http"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
 )
 
 func (s *Server) RegisterRoutes() http.Handler {
 	r := gin.Default()
+	// Only X-Forwarded-For from trusted proxies may change c.ClientIP(), which keys rate limits and sign in lockouts
+	if err := r.SetTrustedProxies(trustedProxiesFromEnv()); err != nil {
+		logger.AppLogger.Fatal("Invalid TRUSTED_PROXIES",
+			zap.Error(err))
+	}
 
 	// Global middleware
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:5173"}, // Add your frontend URL
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowHeaders:     []string{"Accept", "Authorization", "Content-Type"},
+		AllowHeaders:     []string{"Accept", "Authorization", "Content-Type", "X-API-Key"},
+		ExposeHeaders:    []string{"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Retry-After"},
 		AllowCredentials: true, // Enable cookies/auth
 	}))
 
 	// Add database middleware
 	r.Use(middleware.DatabaseMiddleware(s.db))
+	// Add token service middleware
+	r.Use(middleware.TokenMiddleware(s.tokens))
+	// Add permission service middleware
+	r.Use(middleware.RBACMiddleware(s.permissions))
 
 	r.GET("/", s.HelloWorldHandler)
 
 	r.GET("/health", s.healthHandler)
 
+	// Public keys for verifying access tokens offline
+	r.GET("/.well-known/jwks.json", s.jwksHandler)
+
+	// Rate limit policies, limits can be overridden with RATE_LIMIT_<NAME>_REQUESTS/_PERIOD
+	apiLimit := middleware.RateLimit(s.rateLimits, middleware.RateLimitPolicy{
+		Name:  "api",
+		Limit: limitFromEnv("api", 300, time.Minute),
+		Key:   middleware.KeyByIP,
+	})
+	// Credential endpoints get a small bucket per route and IP
+	authLimit := middleware.RateLimit(s.rateLimits, middleware.RateLimitPolicy{
+		Name:  "auth",
+		Limit: limitFromEnv("auth", 10, time.Minute),
+		Key:   middleware.KeyBy(middleware.KeyByRoute, middleware.KeyByIP),
+	})
+	// Every AI response costs money, so it is limited per user
+	aiLimit := middleware.RateLimit(s.rateLimits, middleware.RateLimitPolicy{
+		Name:  "ai",
+		Limit: limitFromEnv("ai", 10, time.Minute),
+		Key:   middleware.KeyByUser,
+	})
+
+	// OAuth2 introspection (RFC 7662) and revocation (RFC 7009) for other services
+	tokenHandler := handler.NewTokenHandler(s.db, s.tokens)
+	oauthServer := r.Group("/oauth", apiLimit, tokenHandler.RequireClient)
+	{
+		oauthServer.POST("/introspect", tokenHandler.Introspect)
+		oauthServer.POST("/revoke", tokenHandler.Revoke)
+	}
+
 	//all routes for v1
-	v1 := r.Group("/api/v1")
+	v1 := r.Group("/api/v1", apiLimit)
 	{
 		// Initialize handlers
-		authHandler := handler.NewAuthHandler(s.db)
+		authHandler := handler.NewAuthHandler(s.db, s.tokens, s.providers, s.sms)
 		userHandler := handler.NewUserHandler(s.db)
-		searchHandler := handler.NewSearchHandler(s.db)
+		searchHandler := handler.NewSearchHandler(s.db, s.permissions)
+		mfaHandler := handler.NewMfaHandler(s.db)
+		webauthnHandler := handler.NewWebauthnHandler(s.db, s.tokens, s.webauthn)
+		socialProfileHandler := handler.NewSocialProfileHandler(s.db)
+		phoneHandler := handler.NewPhoneHandler(s.db, s.sms)
+		apiKeyHandler := handler.NewAPIKeyHandler(s.db)
+		roleHandler := handler.NewRoleHandler(s.db, s.permissions)
+		adminUserHandler := handler.NewAdminUserHandler(s.db, s.tokens, s.permissions)
+		auditHandler := handler.NewAuditHandler(s.db)
 
 		// Auth routes
 		auth := v1.Group("/auth")
 		{
 			auth.GET("/", authHandler.HelloAuth)
 			//sign up route
-			auth.POST("/signup", middleware.ValidateRequest(&validation.SignUpRequest{}, validator.New()), authHandler.SignUp)
+			auth.POST("/signup", authLimit, middleware.ValidateRequest(&validation.SignUpRequest{}, validator.New()), authHandler.SignUp)
 			//verify email route
 			auth.PUT("/verify-email/:token", authHandler.VerifyEmail)
+			//resend verification email route
+			auth.POST("/resend-verification", authLimit, middleware.ValidateRequest(&validation.ResendVerificationRequest{}, validator.New()), authHandler.ResendVerification)
 			//sign in route
-			auth.POST("/signin", middleware.ValidateRequest(&validation.SignInRequest{}, validator.New()), authHandler.SignIn)
+			auth.POST("/signin", authLimit, middleware.ValidateRequest(&validation.SignInRequest{}, validator.New()), authHandler.SignIn)
+			//complete sign in with a second factor
+			auth.POST("/mfa/verify", authLimit, middleware.ValidateRequest(&validation.MfaVerifyRequest{}, validator.New()), authHandler.VerifyMfa)
 			//update token route
 			auth.GET("/update-token", authHandler.UpdateToken)
 			//sign out route
 			auth.POST("/signout", authHandler.SignOut)
+			//sign out from every session
+			auth.POST("/signout-all", middleware.AuthMiddleware(), authHandler.SignOutAll)
+			//password reset routes
+			auth.POST("/forgot-password", authLimit, middleware.ValidateRequest(&validation.ForgotPasswordRequest{}, validator.New()), authHandler.ForgotPassword)
+			auth.POST("/reset-password", authLimit, middleware.ValidateRequest(&validation.ResetPasswordRequest{}, validator.New()), authHandler.ResetPassword)
+			//lift a sign in lockout with the emailed token
+			auth.POST("/unlock-account", authLimit, middleware.ValidateRequest(&validation.UnlockAccountRequest{}, validator.New()), authHandler.UnlockAccount)
+			//passwordless sign in with an emailed link
+			auth.POST("/magic-link", authLimit, middleware.ValidateRequest(&validation.MagicLinkRequest{}, validator.New()), authHandler.RequestMagicLink)
+			auth.POST("/magic-link/verify", authLimit, middleware.ValidateRequest(&validation.MagicLinkVerifyRequest{}, validator.New()), authHandler.VerifyMagicLink)
+			//sign in with a code texted to a verified phone number
+			auth.POST("/phone/signin", authLimit, middleware.ValidateRequest(&validation.PhoneSignInRequest{}, validator.New()), authHandler.RequestPhoneSignIn)
+			auth.POST("/phone/verify", authLimit, middleware.ValidateRequest(&validation.PhoneSignInVerifyRequest{}, validator.New()), authHandler.VerifyPhoneSignIn)
 			//user details from token
 			auth.GET("/user", authHandler.UserDetails)
-			//Google OAuth routes
-			auth.GET("/google/signin", authHandler.GoogleSignIn)
-			auth.GET("/google/callback", authHandler.GoogleCallback)
+			//OAuth routes for every configured provider (google, github)
+			auth.GET("/:provider/signin", authHandler.OAuthSignIn)
+			auth.GET("/:provider/callback", authHandler.OAuthCallback)
+			//swap the one-time code from an OAuth redirect for tokens
+			auth.POST("/exchange", authLimit, middleware.ValidateRequest(&validation.ExchangeCodeRequest{}, validator.New()), authHandler.ExchangeCode)
+			//passkey registration routes
+			auth.POST("/webauthn/register/begin", middleware.AuthMiddleware(), webauthnHandler.BeginRegistration)
+			auth.POST("/webauthn/register/finish", middleware.AuthMiddleware(), webauthnHandler.FinishRegistration)
+			//passkey sign in routes
+			auth.POST("/webauthn/login/begin", webauthnHandler.BeginLogin)
+			auth.POST("/webauthn/login/finish", authLimit, webauthnHandler.FinishLogin)
 		}
 
 		// User routes
@@ -63,20 +140,75 @@ func (s *Server) RegisterRoutes() http.Handler {
 		{
 			user.GET("/", userHandler.HelloUser)
 			// Protected profile route
-			user.GET("/profile", middleware.AuthMiddleware(), userHandler.GetProfile)
+			user.GET("/profile", middleware.ScopedAuthMiddleware(model.ScopeProfileRead), userHandler.GetProfile)
 			// Protected update profile route
-			user.PUT("/profile", middleware.AuthMiddleware(), middleware.ValidateRequest(&validation.UpdateProfileRequest{}, validator.New()), userHandler.UpdateProfile)
+			user.PUT("/profile", middleware.ScopedAuthMiddleware(model.ScopeProfileWrite), middleware.ValidateRequest(&validation.UpdateProfileRequest{}, validator.New()), userHandler.UpdateProfile)
+			// Protected change password route
+			user.PUT("/password", middleware.AuthMiddleware(), middleware.ValidateRequest(&validation.ChangePasswordRequest{}, validator.New()), userHandler.ChangePassword)
+			// Protected session management routes
+			user.GET("/sessions", middleware.AuthMiddleware(), userHandler.GetSessions)
+			user.DELETE("/sessions/:id", middleware.AuthMiddleware(), userHandler.RevokeSession)
+			// Protected two-factor authentication routes
+			user.POST("/mfa/totp/enroll", middleware.AuthMiddleware(), mfaHandler.EnrollTotp)
+			user.POST("/mfa/totp/confirm", middleware.AuthMiddleware(), middleware.ValidateRequest(&validation.TotpCodeRequest{}, validator.New()), mfaHandler.ConfirmTotp)
+			user.DELETE("/mfa/totp", middleware.AuthMiddleware(), middleware.ValidateRequest(&validation.MfaCodeRequest{}, validator.New()), mfaHandler.DisableTotp)
+			user.POST("/mfa/recovery-codes", middleware.AuthMiddleware(), middleware.ValidateRequest(&validation.TotpCodeRequest{}, validator.New()), mfaHandler.RegenerateRecoveryCodes)
+			// Protected passkey management routes
+			user.GET("/webauthn/credentials", middleware.AuthMiddleware(), webauthnHandler.GetCredentials)
+			user.DELETE("/webauthn/credentials/:id", middleware.AuthMiddleware(), webauthnHandler.DeleteCredential)
+			// Protected social account linking routes
+			user.GET("/social-profiles", middleware.AuthMiddleware(), socialProfileHandler.GetSocialProfiles)
+			user.POST("/social-profiles/link", middleware.AuthMiddleware(), socialProfileHandler.LinkSocialProfile)
+			user.DELETE("/social-profiles/:provider", middleware.AuthMiddleware(), socialProfileHandler.UnlinkSocialProfile)
+			// Protected phone number verification routes
+			user.POST("/phone/send-code", middleware.AuthMiddleware(), authLimit, phoneHandler.SendPhoneVerification)
+			user.POST("/phone/verify", middleware.AuthMiddleware(), authLimit, middleware.ValidateRequest(&validation.PhoneCodeRequest{}, validator.New()), phoneHandler.VerifyPhone)
+			// Protected API key management routes, keys can't manage keys
+			user.POST("/api-keys", middleware.AuthMiddleware(), middleware.ValidateRequest(&validation.CreateAPIKeyRequest{}, validator.New()), apiKeyHandler.CreateAPIKey)
+			user.GET("/api-keys", middleware.AuthMiddleware(), apiKeyHandler.GetAPIKeys)
+			user.GET("/api-keys/:id", middleware.AuthMiddleware(), apiKeyHandler.GetAPIKey)
+			user.PATCH("/api-keys/:id", middleware.AuthMiddleware(), middleware.ValidateRequest(&validation.UpdateAPIKeyRequest{}, validator.New()), apiKeyHandler.UpdateAPIKey)
+			user.DELETE("/api-keys/:id", middleware.AuthMiddleware(), apiKeyHandler.DeleteAPIKey)
+			// Protected data export and account deletion, the account is purged after a grace period
+			user.GET("/export", middleware.AuthMiddleware(), userHandler.ExportData)
+			user.DELETE("", middleware.AuthMiddleware(), middleware.ValidateRequest(&validation.DeleteAccountRequest{}, validator.New()), userHandler.DeleteAccount)
+			// Protected security history of the account
+			user.GET("/audit-events", middleware.AuthMiddleware(), auditHandler.GetMyAuditEvents)
 		}
 
 		//search routes
 		search := v1.Group("/search")
 		{
-			search.POST("/create-response", middleware.AuthMiddleware(), middleware.ValidateRequest(&validation.AddResponseRequest{}, validator.New()), searchHandler.CreateResponse)
-			search.GET("/all-search", middleware.AuthMiddleware(), searchHandler.GetAllSearches)
-			search.GET("/single-search/:searchId", middleware.AuthMiddleware(), searchHandler.GetSearchByID)
+			search.POST("/create-response", middleware.ScopedAuthMiddleware(model.ScopeSearchWrite), middleware.RequirePermission(model.PermissionSearchWriteOwn), aiLimit, middleware.ValidateRequest(&validation.AddResponseRequest{}, validator.New()), searchHandler.CreateResponse)
+			search.GET("/all-search", middleware.ScopedAuthMiddleware(model.ScopeSearchRead), middleware.RequirePermission(model.PermissionSearchReadOwn), searchHandler.GetAllSearches)
+			search.GET("/single-search/:searchId", middleware.ScopedAuthMiddleware(model.ScopeSearchRead), middleware.RequirePermission(model.PermissionSearchReadOwn), searchHandler.GetSearchByID)
 
 		}
 
+		// Admin routes
+		admin := v1.Group("/admin", middleware.AuthMiddleware())
+		{
+			// Role and permission management
+			admin.GET("/roles", middleware.RequirePermission(model.PermissionRolesManage), roleHandler.GetRoles)
+			admin.POST("/roles", middleware.RequirePermission(model.PermissionRolesManage), middleware.ValidateRequest(&validation.CreateRoleRequest{}, validator.New()), roleHandler.CreateRole)
+			admin.PUT("/roles/:name/permissions", middleware.RequirePermission(model.PermissionRolesManage), middleware.ValidateRequest(&validation.RolePermissionsRequest{}, validator.New()), roleHandler.SetRolePermissions)
+			admin.GET("/permissions", middleware.RequirePermission(model.PermissionRolesManage), roleHandler.GetPermissions)
+			admin.PUT("/users/:id/role", middleware.RequirePermission(model.PermissionRolesManage), middleware.ValidateRequest(&validation.AssignRoleRequest{}, validator.New()), roleHandler.AssignRole)
+			// User management
+			admin.GET("/users", middleware.RequirePermission(model.PermissionUsersRead), adminUserHandler.GetUsers)
+			admin.GET("/users/:id", middleware.RequirePermission(model.PermissionUsersRead), adminUserHandler.GetUser)
+			admin.POST("/users/:id/verify", middleware.RequirePermission(model.PermissionUsersManage), adminUserHandler.VerifyUser)
+			admin.PUT("/users/:id/status", middleware.RequirePermission(model.PermissionUsersManage), middleware.ValidateRequest(&validation.UserStatusRequest{}, validator.New()), adminUserHandler.SetUserStatus)
+			admin.POST("/users/:id/signout", middleware.RequirePermission(model.PermissionUsersManage), adminUserHandler.SignOutUser)
+			admin.DELETE("/users/:id", middleware.RequirePermission(model.PermissionUsersManage), adminUserHandler.DeleteUser)
+			admin.POST("/users/:id/restore", middleware.RequirePermission(model.PermissionUsersManage), adminUserHandler.RestoreUser)
+			// Impersonation for support staff, every impersonated request is logged
+			admin.POST("/users/:id/impersonate", middleware.RequirePermission(model.PermissionUsersImpersonate), adminUserHandler.Impersonate)
+			admin.GET("/impersonation-logs", middleware.RequirePermission(model.PermissionUsersImpersonate), adminUserHandler.GetImpersonationLogs)
+			// Security audit log of every user
+			admin.GET("/audit-events", middleware.RequirePermission(model.PermissionAuditRead), auditHandler.GetAuditEvents)
+		}
+
 	}
 
 	//This route will catch the error if user hits a route that does not exist in our api.
@@ -95,6 +227,12 @@ func (s *Server) healthHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "OK"})
 }
 
+// jwksHandler publishes the public keys access tokens are signed with
+func (s *Server) jwksHandler(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, s.tokens.JWKS())
+}
+
 func noRouteHandler(c *gin.Context) {
 	c.JSON(http.StatusNotFound, gin.H{"message": "Api not found!!! Wrong url, there is no route in this url."})
 }
@@ -1,24 +1,41 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
 	_ "github.com/joho/godotenv/autoload"
 	"go.uber.org/zap"
 
 	"my-project/internal/database"
 	"my-project/internal/logger"
+	"my-project/internal/oauth"
+	"my-project/internal/purge"
+	"my-project/internal/ratelimit"
+	"my-project/internal/rbac"
+	"my-project/internal/sms"
+	"my-project/internal/token"
 )
 
 type Server struct {
 	port int
 
-	db database.Service
+	db        database.Service
+	tokens    token.Service
+	webauthn  *webauthn.WebAuthn
+	providers *oauth.Registry
+	sms       sms.Sender
+
+	rateLimits  ratelimit.Store
+	permissions *rbac.Service
 }
 
 func NewServer() *http.Server {
@@ -35,9 +52,47 @@ func NewServer() *http.Server {
 		port = 8080
 	}
 
+	tokenConfig, err := token.ConfigFromEnv()
+	if err != nil {
+		logger.AppLogger.Fatal("Invalid token configuration",
+			zap.Error(err))
+	}
+
+	webAuthn, err := webauthn.New(webauthnConfigFromEnv())
+	if err != nil {
+		logger.AppLogger.Fatal("Invalid WebAuthn configuration",
+			zap.Error(err))
+	}
+
+	rateLimits, err := ratelimit.StoreFromEnv()
+	if err != nil {
+		logger.AppLogger.Fatal("Invalid rate limit configuration",
+			zap.Error(err))
+	}
+
+	providers, err := oauth.RegistryFromEnv()
+	if err != nil {
+		logger.AppLogger.Fatal("Invalid OAuth provider configuration",
+			zap.Error(err))
+	}
+
+	smsSender, err := sms.SenderFromEnv()
+	if err != nil {
+		logger.AppLogger.Fatal("Invalid SMS configuration",
+			zap.Error(err))
+	}
+
+	db := database.New()
+
 	NewServer := &Server{
-		port: port,
-		db:   database.New(),
+		port:        port,
+		db:          db,
+		tokens:      token.New(tokenConfig),
+		webauthn:    webAuthn,
+		providers:   providers,
+		sms:         smsSender,
+		rateLimits:  rateLimits,
+		permissions: rbac.ServiceFromEnv(db.DB()),
 	}
 
 	logger.AppLogger.Info("Server initialization",
@@ -53,5 +108,77 @@ func NewServer() *http.Server {
 		WriteTimeout: 30 * time.Second,
 	}
 
+	// Purge accounts deleted by their owners once the grace period is over, until the server shuts down
+	purgeCtx, stopPurge := context.WithCancel(context.Background())
+	server.RegisterOnShutdown(stopPurge)
+	go purge.FromEnv(db.DB()).Run(purgeCtx)
+
 	return server
 }
+
+// limitFromEnv reads the settings of a rate limit policy, refusing to start with an unusable one
+func limitFromEnv(name string, requests int, period time.Duration) ratelimit.Limit {
+	limit, err := ratelimit.LimitFromEnv(name, requests, period)
+	if err != nil {
+		logger.AppLogger.Fatal("Invalid rate limit configuration",
+			zap.Error(err))
+	}
+	return limit
+}
+
+// trustedProxiesFromEnv reads the comma separated proxy IPs and CIDRs in TRUSTED_PROXIES.
+// Without it no proxy is trusted and the client IP is the address of the connection.
+func trustedProxiesFromEnv() []string {
+	value := os.Getenv("TRUSTED_PROXIES")
+	if value == "" {
+		return nil
+	}
+	proxies := strings.Split(value, ",")
+	for i := range proxies {
+		proxies[i] = strings.TrimSpace(proxies[i])
+	}
+	return proxies
+}
+
+// webauthnConfigFromEnv builds the relying party settings used for passkey ceremonies
+func webauthnConfigFromEnv() *webauthn.Config {
+	rpID := os.Getenv("WEBAUTHN_RP_ID")
+	if rpID == "" {
+		rpID = "localhost"
+	}
+
+	displayName := os.Getenv("WEBAUTHN_RP_DISPLAY_NAME")
+	if displayName == "" {
+		displayName = "E-Commerce"
+	}
+
+	origins := []string{"http://localhost:5173"}
+	if value := os.Getenv("WEBAUTHN_RP_ORIGINS"); value != "" {
+		origins = strings.Split(value, ",")
+		for i := range origins {
+			origins[i] = strings.TrimSpace(origins[i])
+		}
+	}
+
+	timeout := webauthn.TimeoutConfig{
+		Enforce:    true,
+		Timeout:    5 * time.Minute,
+		TimeoutUVD: 5 * time.Minute,
+	}
+
+	return &webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: displayName,
+		RPOrigins:     origins,
+		// Passkeys must be discoverable and verify the user, so a passkey alone is a strong sign-in
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			RequireResidentKey: protocol.ResidentKeyRequired(),
+			ResidentKey:        protocol.ResidentKeyRequirementRequired,
+			UserVerification:   protocol.VerificationRequired,
+		},
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        timeout,
+			Registration: timeout,
+		},
+	}
+}
@@ -0,0 +1,67 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// HTTPSender posts messages as JSON to an SMS gateway:
+//
+//	{"from": "...", "to": "+15550100", "message": "..."}
+//
+// authenticated with a bearer token. Any 2xx answer counts as accepted.
+type HTTPSender struct {
+	url    string
+	token  string
+	from   string
+	client *http.Client
+}
+
+func NewHTTPSender(url, token, from string) *HTTPSender {
+	return &HTTPSender{
+		url:    url,
+		token:  token,
+		from:   from,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type gatewayRequest struct {
+	From    string `json:"from,omitempty"`
+	To      string `json:"to"`
+	Message string `json:"message"`
+}
+
+// Send hands the message to the gateway
+func (s *HTTPSender) Send(ctx context.Context, to, message string) error {
+	body, err := json.Marshal(gatewayRequest{From: s.from, To: to, Message: message})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach SMS gateway: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("SMS gateway rejected message: status %d: %s", resp.StatusCode, bytes.TrimSpace(detail))
+	}
+	return nil
+}
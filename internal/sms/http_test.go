@@ -0,0 +1,46 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPSenderSend(t *testing.T) {
+	var got gatewayRequest
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	sender := NewHTTPSender(server.URL, "secret", "E-Commerce")
+	if err := sender.Send(context.Background(), "+15550100", "Your code is 123456"); err != nil {
+		t.Fatal(err)
+	}
+
+	if auth != "Bearer secret" {
+		t.Fatalf("authorization: got %q", auth)
+	}
+	if got.From != "E-Commerce" || got.To != "+15550100" || got.Message != "Your code is 123456" {
+		t.Fatalf("unexpected request body: %+v", got)
+	}
+}
+
+func TestHTTPSenderRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid number", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	sender := NewHTTPSender(server.URL, "", "")
+	if err := sender.Send(context.Background(), "nope", "hi"); err == nil {
+		t.Fatal("expected an error for a rejected message")
+	}
+}
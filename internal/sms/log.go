@@ -0,0 +1,28 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// LogSender writes messages to a writer instead of sending them, for development and tests
+type LogSender struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewLogSender(w io.Writer) *LogSender {
+	return &LogSender{w: w}
+}
+
+// Send writes one line per message
+func (s *LogSender) Send(ctx context.Context, to, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := fmt.Fprintf(s.w, "%s SMS to %s: %q\n", time.Now().Format(time.RFC3339), to, message)
+	return err
+}
@@ -0,0 +1,32 @@
+// Package sms sends text messages through a pluggable gateway.
+package sms
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// Sender delivers a text message to a phone number
+type Sender interface {
+	Send(ctx context.Context, to, message string) error
+}
+
+// SenderFromEnv returns an HTTP gateway sender when SMS_GATEWAY_URL is set. Otherwise messages are
+// written to SMS_LOG_FILE, or to stdout when that is empty too, which is meant for development.
+func SenderFromEnv() (Sender, error) {
+	if gatewayURL := os.Getenv("SMS_GATEWAY_URL"); gatewayURL != "" {
+		return NewHTTPSender(gatewayURL, os.Getenv("SMS_GATEWAY_TOKEN"), os.Getenv("SMS_GATEWAY_FROM")), nil
+	}
+
+	logFile := os.Getenv("SMS_LOG_FILE")
+	if logFile == "" {
+		return NewLogSender(os.Stdout), nil
+	}
+
+	file, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMS_LOG_FILE: %w", err)
+	}
+	return NewLogSender(file), nil
+}
@@ -0,0 +1,96 @@
+package token
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// KindConfig holds the signing key material and lifetime of one token kind.
+// When Keys is set the kind is signed asymmetrically and Secret is ignored.
+type KindConfig struct {
+	Secret []byte
+	Keys   *KeySet
+	TTL    time.Duration
+}
+
+// Config holds the settings shared by every token
+type Config struct {
+	Issuer   string // iss claim
+	Audience string // aud claim
+	Kinds    map[Kind]KindConfig
+}
+
+// kindEnv describes the environment variables of a token kind
+type kindEnv struct {
+	secret         string
+	expiresIn      string
+	fallbackSecret string // used when secret is unset, the kind claim keeps kinds apart
+	defaultTTL     int64  // seconds, 0 means expiresIn is required
+}
+
+// envKeys maps every token kind to its secret and lifetime (seconds) environment variables
+var envKeys = map[Kind]kindEnv{
+	Access:       {secret: "JWT_ACCESS_TOKEN_SECRET", expiresIn: "JWT_ACCESS_TOKEN_EXPIRES_IN"},
+	Refresh:      {secret: "JWT_REFRESH_TOKEN_SECRET", expiresIn: "JWT_REFRESH_TOKEN_EXPIRES_IN"},
+	EmailVerify:  {secret: "JWT_VERIFY_EMAIL_SECRET", expiresIn: "JWT_EMAIL_VERIFY_EXPIRES_IN"},
+	MfaChallenge: {secret: "JWT_MFA_TOKEN_SECRET", expiresIn: "JWT_MFA_TOKEN_EXPIRES_IN", fallbackSecret: "JWT_REFRESH_TOKEN_SECRET", defaultTTL: 300},
+}
+
+// ConfigFromEnv builds the token configuration from environment variables
+func ConfigFromEnv() (Config, error) {
+	config := Config{
+		Issuer:   getEnvOrDefault("JWT_ISSUER", "my-project"),
+		Audience: getEnvOrDefault("JWT_AUDIENCE", "my-project"),
+		Kinds:    make(map[Kind]KindConfig, len(envKeys)),
+	}
+
+	// Access tokens can be signed with asymmetric keys so other services verify them offline
+	var accessKeys *KeySet
+	if keysDir := os.Getenv("JWT_ACCESS_KEYS_DIR"); keysDir != "" {
+		var err error
+		accessKeys, err = LoadKeySet(keysDir, os.Getenv("JWT_ACCESS_SIGNING_KEY_ID"))
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	for kind, env := range envKeys {
+		kindConfig := KindConfig{}
+		if kind == Access && accessKeys != nil {
+			kindConfig.Keys = accessKeys
+		} else {
+			secret := os.Getenv(env.secret)
+			if secret == "" && env.fallbackSecret != "" {
+				secret = os.Getenv(env.fallbackSecret)
+			}
+			if secret == "" {
+				return Config{}, fmt.Errorf("%s must be set", env.secret)
+			}
+			kindConfig.Secret = []byte(secret)
+		}
+
+		expiresInStr := os.Getenv(env.expiresIn)
+		expiresIn, err := strconv.ParseInt(expiresInStr, 10, 64)
+		if expiresInStr == "" && env.defaultTTL > 0 {
+			expiresIn, err = env.defaultTTL, nil
+		}
+		if err != nil || expiresIn <= 0 {
+			return Config{}, fmt.Errorf("invalid %s value: %q", env.expiresIn, expiresInStr)
+		}
+		kindConfig.TTL = time.Second * time.Duration(expiresIn)
+
+		config.Kinds[kind] = kindConfig
+	}
+
+	return config, nil
+}
+
+// getEnvOrDefault retrieves an environment variable or the fallback when it's not set
+func getEnvOrDefault(key, fallback string) string {
+	if val := os.Getenv(key); val != "" {
+		return val
+	}
+	return fallback
+}
@@ -0,0 +1,194 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key is one asymmetric key of a KeySet. Retired keys only keep their public half
+// so tokens signed before a rotation stay verifiable until they expire.
+type Key struct {
+	ID         string
+	Method     jwt.SigningMethod
+	PrivateKey crypto.PrivateKey // nil for verification-only keys
+	PublicKey  crypto.PublicKey
+}
+
+// KeySet holds every key accepted for verification and the one used for signing
+type KeySet struct {
+	signingKeyID string
+	keys         map[string]*Key
+}
+
+// JWK is the public part of a key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// LoadKeySet reads every *.pem file of dir as a key named after its file (without extension).
+// Private keys (PKCS#8 or PKCS#1, RSA or Ed25519) can sign and verify, public keys only verify.
+// signingKeyID selects the private key new tokens are signed with.
+func LoadKeySet(dir, signingKeyID string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("token: failed to list keys in %s: %w", dir, err)
+	}
+
+	keySet := &KeySet{signingKeyID: signingKeyID, keys: make(map[string]*Key, len(paths))}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("token: failed to read key %s: %w", path, err)
+		}
+
+		kid := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		key, err := parseKey(kid, data)
+		if err != nil {
+			return nil, fmt.Errorf("token: failed to parse key %s: %w", path, err)
+		}
+		keySet.keys[kid] = key
+	}
+
+	signingKey, ok := keySet.keys[signingKeyID]
+	if !ok {
+		return nil, fmt.Errorf("token: signing key %q not found in %s", signingKeyID, dir)
+	}
+	if signingKey.PrivateKey == nil {
+		return nil, fmt.Errorf("token: signing key %q has no private key", signingKeyID)
+	}
+
+	return keySet, nil
+}
+
+// parseKey decodes a PEM encoded RSA or Ed25519 key
+func parseKey(kid string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodRS256, PrivateKey: k, PublicKey: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodRS256, PublicKey: k}, nil
+	case ed25519.PrivateKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodEdDSA, PrivateKey: k, PublicKey: k.Public()}, nil
+	case ed25519.PublicKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodEdDSA, PublicKey: k}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+}
+
+// SigningKey returns the key new tokens are signed with
+func (ks *KeySet) SigningKey() *Key {
+	return ks.keys[ks.signingKeyID]
+}
+
+// Lookup returns the key with the given kid
+func (ks *KeySet) Lookup(kid string) (*Key, bool) {
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+// Methods returns the algorithms of the keys in the set
+func (ks *KeySet) Methods() []string {
+	seen := map[string]bool{}
+	var methods []string
+	for _, key := range ks.keys {
+		if alg := key.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+	return methods
+}
+
+// JWKS returns the public keys of the set, sorted by kid
+func (ks *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: make([]JWK, 0, len(ks.keys))}
+	for _, key := range ks.keys {
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+		switch pub := key.PublicKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	sort.Slice(jwks.Keys, func(i, j int) bool { return jwks.Keys[i].Kid < jwks.Keys[j].Kid })
+	return jwks
+}
+
+// PublicKey decodes the RSA or Ed25519 public key of a JWK
+func (jwk JWK) PublicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus of key %q: %w", jwk.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent of key %q: %w", jwk.Kid, err)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || jwk.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key %q", jwk.Kid)
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q of key %q", jwk.Kty, jwk.Kid)
+	}
+}
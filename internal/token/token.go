@@ -0,0 +1,196 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Kind identifies what a token is used for. Every kind is signed with its own key
+// and carries its kind in the payload, so one kind can never be replayed as another.
+// Kinds configured with a KeySet are signed asymmetrically (RS256/EdDSA) with a kid header,
+// all others with HS256 and their own secret.
+type Kind string
+
+const (
+	Access      Kind = "access"
+	Refresh     Kind = "refresh"
+	EmailVerify Kind = "email_verify"
+	// MfaChallenge proves the password step of a sign-in succeeded, it can only be exchanged
+	// for a session together with a second factor
+	MfaChallenge Kind = "mfa_challenge"
+)
+
+// ErrInvalidToken is returned for malformed, expired or otherwise unacceptable tokens
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// Subject is the user a token is issued for
+type Subject struct {
+	ID    uint
+	Email string
+	Role  string
+
+	// Actor is set when someone else acts as the user, e.g. an admin impersonating them
+	Actor *Actor
+	// TTL shortens the lifetime of this token below the kind's configured one, zero keeps it
+	TTL time.Duration
+}
+
+// Actor is the user acting on behalf of the token subject (RFC 8693 act claim)
+type Actor struct {
+	ID      uint   `json:"id"`
+	Subject string `json:"sub"`
+	Email   string `json:"email,omitempty"`
+}
+
+// Claims is the payload of every token issued by this service
+type Claims struct {
+	ID    uint   `json:"id"`
+	Email string `json:"email"`
+	Role  string `json:"role"`
+	Kind  Kind   `json:"kind"`
+	Act   *Actor `json:"act,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Issuer mints signed tokens
+type Issuer interface {
+	// Issue signs a token of the given kind and returns it together with its claims
+	Issue(kind Kind, subject Subject) (string, *Claims, error)
+}
+
+// Verifier validates tokens minted by an Issuer
+type Verifier interface {
+	// Verify checks signature, kind, issuer, audience and time based claims
+	Verify(kind Kind, tokenString string) (*Claims, error)
+}
+
+// Service both issues and verifies tokens
+type Service interface {
+	Issuer
+	Verifier
+
+	// JWKS returns the public keys of every asymmetrically signed kind
+	JWKS() JWKS
+}
+
+type service struct {
+	config Config
+}
+
+// New creates a token service from the given configuration
+func New(config Config) Service {
+	return &service{config: config}
+}
+
+func (s *service) Issue(kind Kind, subject Subject) (string, *Claims, error) {
+	kindConfig, ok := s.config.Kinds[kind]
+	if !ok {
+		return "", nil, fmt.Errorf("token: unknown kind %q", kind)
+	}
+
+	ttl := kindConfig.TTL
+	if subject.TTL > 0 && subject.TTL < ttl {
+		ttl = subject.TTL
+	}
+
+	var act *Actor
+	if subject.Actor != nil {
+		act = &Actor{
+			ID:      subject.Actor.ID,
+			Subject: strconv.FormatUint(uint64(subject.Actor.ID), 10),
+			Email:   subject.Actor.Email,
+		}
+	}
+
+	now := time.Now()
+	claims := &Claims{
+		ID:    subject.ID,
+		Email: subject.Email,
+		Role:  subject.Role,
+		Kind:  kind,
+		Act:   act,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.config.Issuer,
+			Subject:   strconv.FormatUint(uint64(subject.ID), 10),
+			Audience:  jwt.ClaimStrings{s.config.Audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        uuid.New().String(),
+		},
+	}
+
+	var signed string
+	var err error
+	if kindConfig.Keys != nil {
+		signingKey := kindConfig.Keys.SigningKey()
+		unsigned := jwt.NewWithClaims(signingKey.Method, claims)
+		unsigned.Header["kid"] = signingKey.ID
+		signed, err = unsigned.SignedString(signingKey.PrivateKey)
+	} else {
+		signed, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(kindConfig.Secret)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("token: failed to sign %s token: %w", kind, err)
+	}
+
+	return signed, claims, nil
+}
+
+func (s *service) Verify(kind Kind, tokenString string) (*Claims, error) {
+	kindConfig, ok := s.config.Kinds[kind]
+	if !ok {
+		return nil, fmt.Errorf("token: unknown kind %q", kind)
+	}
+
+	validMethods := []string{jwt.SigningMethodHS256.Alg()}
+	if kindConfig.Keys != nil {
+		validMethods = kindConfig.Keys.Methods()
+	}
+
+	claims := &Claims{}
+	parsed, err := jwt.ParseWithClaims(tokenString, claims,
+		func(t *jwt.Token) (interface{}, error) {
+			if kindConfig.Keys == nil {
+				return kindConfig.Secret, nil
+			}
+			kid, _ := t.Header["kid"].(string)
+			key, ok := kindConfig.Keys.Lookup(kid)
+			if !ok {
+				return nil, fmt.Errorf("unknown key id %q", kid)
+			}
+			if t.Method.Alg() != key.Method.Alg() {
+				return nil, fmt.Errorf("algorithm %s does not match key %q", t.Method.Alg(), kid)
+			}
+			return key.PublicKey, nil
+		},
+		jwt.WithValidMethods(validMethods),
+		jwt.WithIssuer(s.config.Issuer),
+		jwt.WithAudience(s.config.Audience),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if !parsed.Valid || claims.Kind != kind {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+func (s *service) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, kindConfig := range s.config.Kinds {
+		if kindConfig.Keys != nil {
+			jwks.Keys = append(jwks.Keys, kindConfig.Keys.JWKS().Keys...)
+		}
+	}
+	return jwks
+}
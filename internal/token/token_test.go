@@ -0,0 +1,189 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func testService(ttl time.Duration) Service {
+	return New(Config{
+		Issuer:   "test-issuer",
+		Audience: "test-audience",
+		Kinds: map[Kind]KindConfig{
+			Access:  {Secret: []byte("access-secret"), TTL: ttl},
+			Refresh: {Secret: []byte("refresh-secret"), TTL: ttl},
+		},
+	})
+}
+
+func TestIssueAndVerify(t *testing.T) {
+	tokens := testService(time.Minute)
+
+	signed, issued, err := tokens.Issue(Access, Subject{ID: 7, Email: "user@example.com", Role: "user"})
+	if err != nil {
+		t.Fatalf("Issue returned error: %v", err)
+	}
+	if issued.ID == 0 || issued.RegisteredClaims.ID == "" || issued.IssuedAt == nil || issued.NotBefore == nil {
+		t.Fatalf("Issue returned incomplete claims: %+v", issued)
+	}
+
+	claims, err := tokens.Verify(Access, signed)
+	if err != nil {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if claims.ID != 7 || claims.Email != "user@example.com" || claims.Role != "user" || claims.Subject != "7" {
+		t.Errorf("Verify returned unexpected claims: %+v", claims)
+	}
+}
+
+func TestIssueWithActor(t *testing.T) {
+	tokens := testService(time.Hour)
+
+	signed, issued, err := tokens.Issue(Access, Subject{ID: 7, Actor: &Actor{ID: 1, Email: "admin@example.com"}, TTL: time.Minute})
+	if err != nil {
+		t.Fatalf("Issue returned error: %v", err)
+	}
+	if ttl := issued.ExpiresAt.Sub(issued.IssuedAt.Time); ttl != time.Minute {
+		t.Errorf("Issue ignored the shorter TTL, got %v", ttl)
+	}
+
+	claims, err := tokens.Verify(Access, signed)
+	if err != nil {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if claims.Act == nil || claims.Act.ID != 1 || claims.Act.Subject != "1" || claims.Act.Email != "admin@example.com" {
+		t.Errorf("Verify returned unexpected actor: %+v", claims.Act)
+	}
+
+	// A TTL can only shorten the configured lifetime
+	_, issued, err = tokens.Issue(Access, Subject{ID: 7, TTL: 2 * time.Hour})
+	if err != nil {
+		t.Fatalf("Issue returned error: %v", err)
+	}
+	if ttl := issued.ExpiresAt.Sub(issued.IssuedAt.Time); ttl != time.Hour {
+		t.Errorf("Issue extended the configured TTL, got %v", ttl)
+	}
+}
+
+func TestVerifyRejectsOtherKind(t *testing.T) {
+	tokens := testService(time.Minute)
+
+	signed, _, err := tokens.Issue(Refresh, Subject{ID: 1})
+	if err != nil {
+		t.Fatalf("Issue returned error: %v", err)
+	}
+
+	if _, err := tokens.Verify(Access, signed); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify accepted a refresh token as access token, err = %v", err)
+	}
+}
+
+func TestVerifyRejectsExpiredToken(t *testing.T) {
+	tokens := testService(-time.Minute)
+
+	signed, _, err := tokens.Issue(Access, Subject{ID: 1})
+	if err != nil {
+		t.Fatalf("Issue returned error: %v", err)
+	}
+
+	if _, err := tokens.Verify(Access, signed); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify accepted an expired token, err = %v", err)
+	}
+}
+
+func TestVerifyRejectsForeignAudience(t *testing.T) {
+	signed, _, err := testService(time.Minute).Issue(Access, Subject{ID: 1})
+	if err != nil {
+		t.Fatalf("Issue returned error: %v", err)
+	}
+
+	other := New(Config{
+		Issuer:   "test-issuer",
+		Audience: "another-audience",
+		Kinds:    map[Kind]KindConfig{Access: {Secret: []byte("access-secret"), TTL: time.Minute}},
+	})
+	if _, err := other.Verify(Access, signed); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify accepted a token for another audience, err = %v", err)
+	}
+}
+
+func writeKey(t *testing.T, dir, kid string, der []byte, blockType string) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAsymmetricKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+
+	// The old key is retired: only its public half is kept for verification
+	oldPublic, oldPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldPublicDER, _ := x509.MarshalPKIXPublicKey(oldPublic)
+	writeKey(t, dir, "2024-old", oldPublicDER, "PUBLIC KEY")
+
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newPrivateDER, _ := x509.MarshalPKCS8PrivateKey(newKey)
+	writeKey(t, dir, "2025-new", newPrivateDER, "PRIVATE KEY")
+
+	keys, err := LoadKeySet(dir, "2025-new")
+	if err != nil {
+		t.Fatalf("LoadKeySet returned error: %v", err)
+	}
+	tokens := New(Config{
+		Issuer:   "test-issuer",
+		Audience: "test-audience",
+		Kinds:    map[Kind]KindConfig{Access: {Keys: keys, TTL: time.Minute}},
+	})
+
+	// New tokens are signed with the active RSA key
+	signed, _, err := tokens.Issue(Access, Subject{ID: 3})
+	if err != nil {
+		t.Fatalf("Issue returned error: %v", err)
+	}
+	if _, err := tokens.Verify(Access, signed); err != nil {
+		t.Errorf("Verify rejected a token signed with the active key: %v", err)
+	}
+
+	// Tokens signed with the retired key before the rotation still verify
+	old := jwt.NewWithClaims(jwt.SigningMethodEdDSA, &Claims{
+		ID:   3,
+		Kind: Access,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "test-issuer",
+			Audience:  jwt.ClaimStrings{"test-audience"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	})
+	old.Header["kid"] = "2024-old"
+	oldSigned, err := old.SignedString(oldPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tokens.Verify(Access, oldSigned); err != nil {
+		t.Errorf("Verify rejected a token signed with the retired key: %v", err)
+	}
+
+	jwks := tokens.JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].Kty != "OKP" || jwks.Keys[1].Kty != "RSA" {
+		t.Errorf("JWKS returned unexpected keys: %+v", jwks.Keys)
+	}
+}
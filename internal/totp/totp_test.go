@@ -0,0 +1,52 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// Test vectors from RFC 6238 appendix B (SHA1), truncated to 6 digits
+func TestCodeAtRFC6238(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := CodeAt(secret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("CodeAt returned error: %v", err)
+		}
+		if code != tt.code {
+			t.Errorf("CodeAt(%d) = %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestValidateAcceptsSkew(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	previous, _ := CodeAt(secret, Step(now)-1)
+	if step, ok := Validate(secret, previous, now); !ok || step != Step(now)-1 {
+		t.Errorf("Validate rejected the code of the previous period")
+	}
+
+	tooOld, _ := CodeAt(secret, Step(now)-3)
+	if _, ok := Validate(secret, tooOld, now); ok {
+		t.Errorf("Validate accepted a code outside the allowed skew")
+	}
+}
@@ -0,0 +1,24 @@
+package validation
+
+// CreateRoleRequest defines the validation schema for creating a role
+type CreateRoleRequest struct {
+	Name        string   `json:"name" binding:"required,max=50,lowercase"`
+	Description string   `json:"description" binding:"max=255"`
+	Permissions []string `json:"permissions" binding:"dive,max=100"`
+}
+
+// RolePermissionsRequest defines the validation schema for replacing the permissions of a role
+type RolePermissionsRequest struct {
+	Permissions []string `json:"permissions" binding:"dive,max=100"`
+}
+
+// AssignRoleRequest defines the validation schema for assigning a role to a user
+type AssignRoleRequest struct {
+	Role string `json:"role" binding:"required,max=50"`
+}
+
+// UserStatusRequest defines the validation schema for disabling, banning or reactivating a user
+type UserStatusRequest struct {
+	Status string `json:"status" binding:"required,oneof=active disabled banned"`
+	Reason string `json:"reason" binding:"max=255"`
+}
@@ -12,3 +12,63 @@ type SignInRequest struct {
 	Email    string `json:"email" binding:"required,email,max=255"`
 	Password string `json:"password" binding:"required,min=6"`
 }
+
+// ForgotPasswordRequest defines the validation schema for requesting a password reset
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email,max=255"`
+}
+
+// ResetPasswordRequest defines the validation schema for resetting a password
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6,max=72"`
+}
+
+// ResendVerificationRequest defines the validation schema for resending the verification email
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email,max=255"`
+}
+
+// MfaVerifyRequest defines the validation schema for completing a sign-in with a second factor
+type MfaVerifyRequest struct {
+	MfaToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code" binding:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recovery_code" binding:"required_without=Code,omitempty,max=20"`
+}
+
+// UnlockAccountRequest defines the validation schema for unlocking an account with an emailed token
+type UnlockAccountRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ExchangeCodeRequest defines the validation schema for swapping an OAuth authorization code for tokens
+type ExchangeCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// MagicLinkRequest defines the validation schema for requesting a passwordless sign-in link
+type MagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email,max=255"`
+}
+
+// MagicLinkVerifyRequest defines the validation schema for signing in with an emailed magic link token
+type MagicLinkVerifyRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// PhoneSignInRequest defines the validation schema for requesting an SMS sign-in code
+type PhoneSignInRequest struct {
+	PhoneNumber string `json:"phone_number" binding:"required,max=20"`
+}
+
+// PhoneSignInVerifyRequest defines the validation schema for signing in with an SMS code
+type PhoneSignInVerifyRequest struct {
+	PhoneNumber string `json:"phone_number" binding:"required,max=20"`
+	Code        string `json:"code" binding:"required,len=6,numeric"`
+}
+
+// TokenRequest defines the validation schema of the introspection (RFC 7662) and revocation (RFC 7009) endpoints
+type TokenRequest struct {
+	Token         string `form:"token" binding:"required"`
+	TokenTypeHint string `form:"token_type_hint" binding:"omitempty,oneof=access_token refresh_token"`
+}
@@ -14,3 +14,46 @@ type UpdateProfileRequest struct {
 	Road    string                `form:"road" validate:"omitempty,max=100"`
 	Image   *multipart.FileHeader `form:"image" validate:"omitempty"`
 }
+
+// ChangePasswordRequest defines the validation schema for changing the password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=6,max=72"`
+}
+
+// TotpCodeRequest defines the validation schema for requests confirmed with an authenticator code
+type TotpCodeRequest struct {
+	Code string `json:"code" binding:"required,len=6,numeric"`
+}
+
+// MfaCodeRequest defines the validation schema for requests confirmed with an authenticator or recovery code
+type MfaCodeRequest struct {
+	Code         string `json:"code" binding:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recovery_code" binding:"required_without=Code,omitempty,max=20"`
+}
+
+// PhoneCodeRequest defines the validation schema for confirming the phone number with an SMS code
+type PhoneCodeRequest struct {
+	Code string `json:"code" binding:"required,len=6,numeric"`
+}
+
+// CreateAPIKeyRequest defines the validation schema for creating an API key
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1,dive,oneof=search:read search:write profile:read profile:write"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"omitempty,min=1,max=365"` // Omit for a key that never expires
+}
+
+// UpdateAPIKeyRequest defines the validation schema for renaming an API key or changing its scopes
+type UpdateAPIKeyRequest struct {
+	Name   string   `json:"name" binding:"omitempty,max=100"`
+	Scopes []string `json:"scopes" binding:"omitempty,min=1,dive,oneof=search:read search:write profile:read profile:write"`
+}
+
+// DeleteAccountRequest defines the validation schema for deleting the own account. Social sign ups confirm
+// with the temporary password they got by email, accounts with MFA need an authenticator or recovery code too.
+type DeleteAccountRequest struct {
+	Password     string `json:"password" binding:"required,max=72"`
+	Code         string `json:"code" binding:"omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recovery_code" binding:"omitempty,max=20"`
+}